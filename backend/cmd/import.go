@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/config"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event/eventrepo"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint/waypointrepo"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/validate"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/db"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/trackio"
+	"github.com/google/uuid"
+)
+
+// importChunkSize is how many waypoints are inserted per transaction
+const importChunkSize = 500
+
+// runImport backfills waypoints from a CSV or GPX file, e.g. the serial log
+// of a tracker or a phone recording. Rows go through the same validation as
+// the register endpoint. Nothing is inserted when a row is rejected, unless
+// -skip-invalid is given. Waypoints are stored for the -device given,
+// import:<file name> by default, and a point of that device at the same time
+// is never stored twice: running the import again adds only the new rows.
+func runImport(ctx context.Context, conf *config.Config, log *logger.Log, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "input format, csv or gpx (default: the file extension)")
+	eventFlag := fs.String("event", "", "id of the event the waypoints belong to")
+	deviceFlag := fs.String("device", "", "device the waypoints are stored for (default: import:<file name>)")
+	dryRun := fs.Bool("dry-run", false, "validate the file without inserting anything")
+	skipInvalid := fs.Bool("skip-invalid", false, "import the valid rows even when some are rejected")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: saint-tracker import [-format csv|gpx] [-event id] [-device id] [-dry-run] [-skip-invalid] file")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one file")
+	}
+	path := fs.Arg(0)
+
+	deviceID := *deviceFlag
+	if deviceID == "" {
+		deviceID = "import:" + filepath.Base(path)
+	}
+
+	read, err := importReader(*format, path)
+	if err != nil {
+		return err
+	}
+
+	var eventID *uuid.UUID
+	if *eventFlag != "" {
+		id, err := uuid.Parse(*eventFlag)
+		if err != nil {
+			return fmt.Errorf("invalid event id %q", *eventFlag)
+		}
+		eventID = &id
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var waypoints []*waypoint.WaypointDTO
+	rejected := 0
+	reject := func(line int, msg string) {
+		rejected++
+		fmt.Fprintf(os.Stderr, "%s:%d: %s\n", path, line, msg)
+	}
+
+	err = read(f, func(line int, p trackio.Point, err error) error {
+		if err != nil {
+			reject(line, err.Error())
+			return nil
+		}
+
+		wc := &waypoint.NewWaypointDTO{
+			Latitude:   p.Latitude,
+			Longitude:  p.Longitude,
+			Speed:      int(math.Round(p.Speed)),
+			Altitude:   p.Altitude,
+			Heading:    p.Heading,
+			HDOP:       p.HDOP,
+			Satellites: p.Satellites,
+			Accuracy:   p.Accuracy,
+			CreatedAt:  p.Time.Unix(),
+		}
+		if err := wc.Validate(); err != nil {
+			reject(line, strings.Join(validate.SplitErrors(err), "; "))
+			return nil
+		}
+
+		waypoints = append(waypoints, &waypoint.WaypointDTO{
+			ID:         uuid.New(),
+			EventID:    eventID,
+			Latitude:   wc.Latitude,
+			Longitude:  wc.Longitude,
+			Speed:      wc.Speed,
+			Altitude:   wc.Altitude,
+			Heading:    wc.Heading,
+			HDOP:       wc.HDOP,
+			Satellites: wc.Satellites,
+			Accuracy:   wc.Accuracy,
+			DeviceID:   deviceID,
+			CreatedAt:  time.Unix(wc.CreatedAt, 0).UTC(),
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	fmt.Printf("%s: %d valid, %d rejected\n", path, len(waypoints), rejected)
+	if rejected > 0 && !*skipInvalid {
+		return errors.New("some rows were rejected, fix them or run with -skip-invalid")
+	}
+	if *dryRun || len(waypoints) == 0 {
+		return nil
+	}
+
+	database, err := db.Init(conf)
+	if err != nil {
+		return fmt.Errorf("database connection error, %w", err)
+	}
+	defer database.Close()
+
+	if eventID != nil {
+		if _, err := eventrepo.NewDB(database).GetByID(ctx, *eventID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("event %s not found", eventID)
+			}
+			return err
+		}
+	}
+
+	repo := waypointrepo.NewDB(database)
+	for start := 0; start < len(waypoints); start += importChunkSize {
+		end := min(start+importChunkSize, len(waypoints))
+		if err := repo.CreateBatch(ctx, waypoints[start:end]); err != nil {
+			return fmt.Errorf("inserted %d of %d waypoints, %w", start, len(waypoints), err)
+		}
+	}
+
+	duplicates := 0
+	for _, w := range waypoints {
+		if w.Duplicate {
+			duplicates++
+		}
+	}
+	log.Infof("imported %d waypoints from %s for device %s, %d already stored", len(waypoints)-duplicates, path, deviceID, duplicates)
+	fmt.Println("restart the server to refresh its cached tracks and statistics")
+	return nil
+}
+
+// importReader picks the reader of the format, guessing it from the file
+// extension when not given
+func importReader(format, path string) (func(r io.Reader, fn trackio.ReadFunc) error, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	switch format {
+	case "csv":
+		return trackio.ReadCSV, nil
+	case "gpx":
+		return trackio.ReadGPX, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q, expected csv or gpx", format)
+	}
+}
@@ -22,6 +22,14 @@ func main() {
 	log := logger.Init(conf)
 	ctx := context.Background()
 
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(ctx, conf, log, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "import error, %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := run(ctx, conf, log); err != nil {
 		log.Fatalf("run error, %v", err)
 		os.Exit(1)
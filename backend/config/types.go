@@ -3,10 +3,19 @@ package config
 import "time"
 
 type Config struct {
-	App      string `env:"APP_ENV"`
-	Server   serverConfig
-	Logger   loggerConfig
-	Database databaseConfig
+	App       string `env:"APP_ENV"`
+	Server    serverConfig
+	Logger    loggerConfig
+	Database  databaseConfig
+	Auth      authConfig
+	Device    deviceConfig
+	Stop      stopConfig
+	Quality   qualityConfig
+	Position  positionConfig
+	MapMatch  mapMatchConfig
+	WebSocket websocketConfig
+	MQTT      mqttConfig
+	UDP       udpConfig
 }
 
 type serverConfig struct {
@@ -31,3 +40,66 @@ type databaseConfig struct {
 	Driver   string `env:"DB_DRIVER"`
 	Filename string `env:"DB_FILENAME"`
 }
+
+type authConfig struct {
+	JWTSecret     string        `env:"AUTH_JWTSECRET"`
+	TokenTTL      time.Duration `env:"AUTH_TOKENTTL" envDefault:"12h"`
+	AdminUsername string        `env:"AUTH_ADMINUSERNAME" envDefault:"admin"`
+	AdminPassword string        `env:"AUTH_ADMINPASSWORD"`
+}
+
+type deviceConfig struct {
+	CacheTTL              time.Duration `env:"DEVICE_CACHETTL" envDefault:"1h"`
+	TokenGracePeriod      time.Duration `env:"DEVICE_TOKENGRACEPERIOD" envDefault:"24h"`
+	LastSeenFlushInterval time.Duration `env:"DEVICE_LASTSEENFLUSHINTERVAL" envDefault:"10s"`
+}
+
+type stopConfig struct {
+	DefaultRadius float64       `env:"STOP_DEFAULTRADIUS" envDefault:"25"`
+	ExitRadius    float64       `env:"STOP_EXITRADIUS" envDefault:"40"`
+	MinDuration   time.Duration `env:"STOP_MINDURATION" envDefault:"45s"`
+}
+
+// qualityConfig sets the ingestion filter, a zero limit disables its check
+type qualityConfig struct {
+	MaxSpeed float64 `env:"QUALITY_MAXSPEED" envDefault:"60"`
+	MaxHDOP  float64 `env:"QUALITY_MAXHDOP" envDefault:"5"`
+	Reject   bool    `env:"QUALITY_REJECT" envDefault:"false"`
+}
+
+// positionConfig sets the Kalman filter smoothing the live position of the
+// trackers, Acceleration is its process noise in m/s²
+type positionConfig struct {
+	Enabled      bool    `env:"POSITION_ENABLED" envDefault:"true"`
+	Acceleration float64 `env:"POSITION_ACCELERATION" envDefault:"0.5"`
+}
+
+// mapMatchConfig sets the road network the tracks are snapped to, matching
+// is disabled when no GeoJSON file is given. Distances are in meters.
+type mapMatchConfig struct {
+	Roads  string  `env:"MAPMATCH_ROADS"`
+	Radius float64 `env:"MAPMATCH_RADIUS" envDefault:"50"`
+	Sigma  float64 `env:"MAPMATCH_SIGMA" envDefault:"10"`
+	Beta   float64 `env:"MAPMATCH_BETA" envDefault:"20"`
+}
+
+// websocketConfig sets the heartbeat of the live connections. Clients are
+// pinged every PingInterval and disconnected when nothing, not even a pong,
+// arrives for PongWait. IdleTimeout is the backstop after which the hub
+// reaps a silent connection whatever its transport.
+type websocketConfig struct {
+	PingInterval time.Duration `env:"WEBSOCKET_PINGINTERVAL" envDefault:"30s"`
+	PongWait     time.Duration `env:"WEBSOCKET_PONGWAIT" envDefault:"60s"`
+	WriteWait    time.Duration `env:"WEBSOCKET_WRITEWAIT" envDefault:"10s"`
+	IdleTimeout  time.Duration `env:"WEBSOCKET_IDLETIMEOUT" envDefault:"2m"`
+}
+
+type mqttConfig struct {
+	Enabled bool   `env:"MQTT_ENABLED" envDefault:"false"`
+	Address string `env:"MQTT_ADDRESS" envDefault:":1883"`
+}
+
+type udpConfig struct {
+	Enabled bool   `env:"UDP_ENABLED" envDefault:"false"`
+	Address string `env:"UDP_ADDRESS" envDefault:":9877"`
+}
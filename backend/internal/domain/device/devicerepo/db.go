@@ -0,0 +1,89 @@
+package devicerepo
+
+import (
+	"context"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/device"
+	"github.com/jmoiron/sqlx"
+)
+
+const columns = `id, serial_number, token, previous_token, previous_token_expires_at, frame_key, previous_frame_key, device_name, is_active, created_at, update_at, last_seen, notes`
+
+type repository struct {
+	*sqlx.DB
+}
+
+func NewDB(db *sqlx.DB) *repository {
+	return &repository{db}
+}
+
+func (dbrepo *repository) GetList(ctx context.Context) ([]*device.DeviceDTO, error) {
+	var models []*Model
+	query := `SELECT ` + columns + ` FROM esp32_devices ORDER BY serial_number`
+
+	if err := dbrepo.SelectContext(ctx, &models, query); err != nil {
+		return nil, err
+	}
+
+	dtos := make([]*device.DeviceDTO, 0, len(models))
+	for _, model := range models {
+		dtos = append(dtos, model.intoDTO())
+	}
+	return dtos, nil
+}
+
+func (dbrepo *repository) GetByID(ctx context.Context, id int64) (*device.DeviceDTO, error) {
+	model := new(Model)
+	query := `SELECT ` + columns + ` FROM esp32_devices WHERE id = $1`
+
+	if err := dbrepo.GetContext(ctx, model, query, id); err != nil {
+		return nil, err
+	}
+	return model.intoDTO(), nil
+}
+
+func (dbrepo *repository) Create(ctx context.Context, d *device.DeviceDTO) error {
+	query := `
+		INSERT INTO esp32_devices
+			(serial_number, token, frame_key, device_name, is_active, notes)
+		VALUES
+			(:serial_number, :token, :frame_key, :device_name, :is_active, :notes)
+	`
+
+	res, err := dbrepo.NamedExecContext(ctx, query, intoModel(d))
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	d.ID = id
+	return nil
+}
+
+func (dbrepo *repository) Update(ctx context.Context, d *device.DeviceDTO) error {
+	query := `
+		UPDATE esp32_devices SET
+			token = :token,
+			previous_token = :previous_token,
+			previous_token_expires_at = :previous_token_expires_at,
+			frame_key = :frame_key,
+			previous_frame_key = :previous_frame_key,
+			device_name = :device_name,
+			is_active = :is_active,
+			notes = :notes
+		WHERE id = :id
+	`
+
+	_, err := dbrepo.NamedExecContext(ctx, query, intoModel(d))
+	return err
+}
+
+func (dbrepo *repository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM esp32_devices WHERE id = $1`
+
+	_, err := dbrepo.ExecContext(ctx, query, id)
+	return err
+}
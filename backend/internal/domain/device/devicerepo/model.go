@@ -0,0 +1,70 @@
+package devicerepo
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/device"
+)
+
+type Model struct {
+	ID                     int64          `db:"id"`
+	SerialNumber           string         `db:"serial_number"`
+	Token                  string         `db:"token"`
+	PreviousToken          sql.NullString `db:"previous_token"`
+	PreviousTokenExpiresAt sql.NullTime   `db:"previous_token_expires_at"`
+	FrameKey               sql.NullString `db:"frame_key"`
+	PreviousFrameKey       sql.NullString `db:"previous_frame_key"`
+	DeviceName             sql.NullString `db:"device_name"`
+	IsActive               bool           `db:"is_active"`
+	CreatedAt              time.Time      `db:"created_at"`
+	UpdatedAt              time.Time      `db:"update_at"`
+	LastSeen               sql.NullTime   `db:"last_seen"`
+	Notes                  sql.NullString `db:"notes"`
+}
+
+func (m *Model) intoDTO() *device.DeviceDTO {
+	dto := &device.DeviceDTO{
+		ID:               m.ID,
+		SerialNumber:     m.SerialNumber,
+		Token:            m.Token,
+		PreviousToken:    m.PreviousToken.String,
+		FrameKey:         m.FrameKey.String,
+		PreviousFrameKey: m.PreviousFrameKey.String,
+		DeviceName:       m.DeviceName.String,
+		IsActive:         m.IsActive,
+		CreatedAt:        m.CreatedAt,
+		UpdatedAt:        m.UpdatedAt,
+		Notes:            m.Notes.String,
+	}
+	if m.PreviousTokenExpiresAt.Valid {
+		dto.PreviousTokenExpiresAt = &m.PreviousTokenExpiresAt.Time
+	}
+	if m.LastSeen.Valid {
+		dto.LastSeen = &m.LastSeen.Time
+	}
+	return dto
+}
+
+func intoModel(d *device.DeviceDTO) *Model {
+	m := &Model{
+		ID:               d.ID,
+		SerialNumber:     d.SerialNumber,
+		Token:            d.Token,
+		PreviousToken:    sql.NullString{String: d.PreviousToken, Valid: d.PreviousToken != ""},
+		FrameKey:         sql.NullString{String: d.FrameKey, Valid: d.FrameKey != ""},
+		PreviousFrameKey: sql.NullString{String: d.PreviousFrameKey, Valid: d.PreviousFrameKey != ""},
+		DeviceName:       sql.NullString{String: d.DeviceName, Valid: d.DeviceName != ""},
+		IsActive:         d.IsActive,
+		CreatedAt:        d.CreatedAt,
+		UpdatedAt:        d.UpdatedAt,
+		Notes:            sql.NullString{String: d.Notes, Valid: d.Notes != ""},
+	}
+	if d.PreviousTokenExpiresAt != nil {
+		m.PreviousTokenExpiresAt = sql.NullTime{Time: *d.PreviousTokenExpiresAt, Valid: true}
+	}
+	if d.LastSeen != nil {
+		m.LastSeen = sql.NullTime{Time: *d.LastSeen, Valid: true}
+	}
+	return m
+}
@@ -0,0 +1,259 @@
+package deviceuc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/config"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/device"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/secret"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/db"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+)
+
+type iDBRepository interface {
+	GetList(ctx context.Context) ([]*device.DeviceDTO, error)
+	GetByID(ctx context.Context, id int64) (*device.DeviceDTO, error)
+	Create(ctx context.Context, d *device.DeviceDTO) error
+	Update(ctx context.Context, d *device.DeviceDTO) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// iCache is the authentication cache kept by the device middleware
+type iCache interface {
+	Delete(deviceID string)
+}
+
+// iLastSeen buffers the device contact times before they reach the db
+type iLastSeen interface {
+	Pending(deviceID string) (time.Time, bool)
+}
+
+type UseCase struct {
+	conf     *config.Config
+	log      *logger.Log
+	dbRepo   iDBRepository
+	cache    iCache
+	lastSeen iLastSeen
+}
+
+func New(conf *config.Config, log *logger.Log, dbRepo iDBRepository, cache iCache, lastSeen iLastSeen) *UseCase {
+	return &UseCase{
+		conf:     conf,
+		log:      log,
+		dbRepo:   dbRepo,
+		cache:    cache,
+		lastSeen: lastSeen,
+	}
+}
+
+// HashLegacyTokens replaces any token still stored in plaintext, such as
+// the ones seeded by migrations, with its salted hash and derives its frame
+// key while the plain token is still known
+func (uc *UseCase) HashLegacyTokens(ctx context.Context) error {
+	devices, err := uc.dbRepo.GetList(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		if secret.IsHashed(d.Token) {
+			if d.FrameKey == "" && uc.conf.UDP.Enabled {
+				uc.log.Warnf("device %s has no frame key, rotate its token to use the UDP protocol", d.SerialNumber)
+			}
+			continue
+		}
+
+		hash, err := secret.HashToken(d.Token)
+		if err != nil {
+			return err
+		}
+		d.FrameKey = secret.FrameKey(d.Token)
+		d.Token = hash
+
+		if err := uc.dbRepo.Update(ctx, d); err != nil {
+			return err
+		}
+		uc.cache.Delete(d.SerialNumber)
+		uc.log.Infof("hashed legacy token of device %s", d.SerialNumber)
+	}
+	return nil
+}
+
+func (uc *UseCase) GetList(ctx context.Context) ([]*device.DeviceDTO, error) {
+	res, err := uc.dbRepo.GetList(ctx)
+	if err != nil {
+		uc.log.Errorf("device list error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve devices data from db")
+	}
+	for _, d := range res {
+		uc.withLastSeen(d)
+	}
+	return res, nil
+}
+
+func (uc *UseCase) Get(ctx context.Context, id int64) (*device.DeviceDTO, error) {
+	res, err := uc.dbRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperrors.New(httperrors.NotFound, "Device not found")
+		}
+		uc.log.Errorf("device get error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve device data from db")
+	}
+	return uc.withLastSeen(res), nil
+}
+
+// Create registers a new tracker and returns its freshly generated token
+func (uc *UseCase) Create(ctx context.Context, dc *device.NewDeviceDTO) (*device.DeviceTokenDTO, error) {
+	token, hash, err := uc.newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &device.DeviceDTO{
+		SerialNumber: dc.SerialNumber,
+		Token:        hash,
+		FrameKey:     secret.FrameKey(token),
+		DeviceName:   dc.DeviceName,
+		IsActive:     true,
+		Notes:        dc.Notes,
+	}
+
+	if err := uc.dbRepo.Create(ctx, d); err != nil {
+		if db.IsUniqueViolation(err) {
+			return nil, httperrors.New(httperrors.AlreadyExists, "A device with this serial number already exists")
+		}
+		uc.log.Errorf("device create error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Error inserting device")
+	}
+
+	// Reload to get the defaults filled in by the db
+	d, err = uc.Get(ctx, d.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &device.DeviceTokenDTO{DeviceDTO: d, Token: token}, nil
+}
+
+func (uc *UseCase) Update(ctx context.Context, id int64, du *device.UpdateDeviceDTO) (*device.DeviceDTO, error) {
+	d, err := uc.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	d.DeviceName = du.DeviceName
+	d.Notes = du.Notes
+
+	return uc.save(ctx, d)
+}
+
+// RotateToken issues a new token for the device. The old one keeps working
+// for the configured grace period so the tracker can be reflashed without
+// losing points.
+func (uc *UseCase) RotateToken(ctx context.Context, id int64) (*device.DeviceTokenDTO, error) {
+	d, err := uc.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	token, hash, err := uc.newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	d.PreviousToken = ""
+	d.PreviousFrameKey = ""
+	d.PreviousTokenExpiresAt = nil
+	if grace := uc.conf.Device.TokenGracePeriod; grace > 0 {
+		expiresAt := time.Now().UTC().Add(grace)
+		d.PreviousToken = d.Token
+		d.PreviousFrameKey = d.FrameKey
+		d.PreviousTokenExpiresAt = &expiresAt
+	}
+	d.Token = hash
+	d.FrameKey = secret.FrameKey(token)
+
+	d, err = uc.save(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	return &device.DeviceTokenDTO{DeviceDTO: d, Token: token}, nil
+}
+
+func (uc *UseCase) Activate(ctx context.Context, id int64) (*device.DeviceDTO, error) {
+	return uc.setActive(ctx, id, true)
+}
+
+func (uc *UseCase) Deactivate(ctx context.Context, id int64) (*device.DeviceDTO, error) {
+	return uc.setActive(ctx, id, false)
+}
+
+func (uc *UseCase) Delete(ctx context.Context, id int64) error {
+	d, err := uc.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.dbRepo.Delete(ctx, id); err != nil {
+		uc.log.Errorf("device delete error, %v", err)
+		return httperrors.New(httperrors.Internal, "Error deleting device")
+	}
+	uc.cache.Delete(d.SerialNumber)
+	return nil
+}
+
+func (uc *UseCase) setActive(ctx context.Context, id int64, active bool) (*device.DeviceDTO, error) {
+	d, err := uc.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	d.IsActive = active
+
+	return uc.save(ctx, d)
+}
+
+func (uc *UseCase) save(ctx context.Context, d *device.DeviceDTO) (*device.DeviceDTO, error) {
+	if err := uc.dbRepo.Update(ctx, d); err != nil {
+		uc.log.Errorf("device update error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Error updating device")
+	}
+
+	// Drop the cached credentials so revocations apply at once
+	uc.cache.Delete(d.SerialNumber)
+
+	return uc.Get(ctx, d.ID)
+}
+
+// withLastSeen merges the contact time not yet flushed to the db and fills
+// in how long ago the device was last heard from
+func (uc *UseCase) withLastSeen(d *device.DeviceDTO) *device.DeviceDTO {
+	if t, ok := uc.lastSeen.Pending(d.SerialNumber); ok && (d.LastSeen == nil || t.After(*d.LastSeen)) {
+		d.LastSeen = &t
+	}
+	if d.LastSeen != nil {
+		ago := int64(time.Since(*d.LastSeen).Seconds())
+		d.LastSeenAgo = &ago
+	}
+	return d
+}
+
+// newToken generates a device token and the hash to store for it
+func (uc *UseCase) newToken() (string, string, error) {
+	token, err := secret.GenerateToken(secret.TokenLength)
+	if err != nil {
+		uc.log.Errorf("device token generation error, %v", err)
+		return "", "", httperrors.New(httperrors.Internal, "Could not generate device token")
+	}
+
+	hash, err := secret.HashToken(token)
+	if err != nil {
+		uc.log.Errorf("device token hashing error, %v", err)
+		return "", "", httperrors.New(httperrors.Internal, "Could not generate device token")
+	}
+	return token, hash, nil
+}
@@ -0,0 +1,158 @@
+package deviceweb
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/device"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/validate"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/labstack/echo/v4"
+)
+
+type iUseCase interface {
+	GetList(ctx context.Context) ([]*device.DeviceDTO, error)
+	Get(ctx context.Context, id int64) (*device.DeviceDTO, error)
+	Create(ctx context.Context, dc *device.NewDeviceDTO) (*device.DeviceTokenDTO, error)
+	Update(ctx context.Context, id int64, du *device.UpdateDeviceDTO) (*device.DeviceDTO, error)
+	RotateToken(ctx context.Context, id int64) (*device.DeviceTokenDTO, error)
+	Activate(ctx context.Context, id int64) (*device.DeviceDTO, error)
+	Deactivate(ctx context.Context, id int64) (*device.DeviceDTO, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+type controller struct {
+	deviceUC iUseCase
+	log      *logger.Log
+}
+
+func newController(deviceUC iUseCase, log *logger.Log) *controller {
+	return &controller{deviceUC, log}
+}
+
+func (con *controller) list(c echo.Context) error {
+	d, err := con.deviceUC.GetList(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, d)
+}
+
+func (con *controller) get(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	d, err := con.deviceUC.Get(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, d)
+}
+
+func (con *controller) create(c echo.Context) error {
+	dto := new(device.NewDeviceDTO)
+	if err := c.Bind(dto); err != nil {
+		return httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
+	}
+	if err := dto.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	d, err := con.deviceUC.Create(c.Request().Context(), dto)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, d)
+}
+
+func (con *controller) update(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	dto := new(device.UpdateDeviceDTO)
+	if err := c.Bind(dto); err != nil {
+		return httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
+	}
+	if err := dto.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	d, err := con.deviceUC.Update(c.Request().Context(), id, dto)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, d)
+}
+
+func (con *controller) rotateToken(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	d, err := con.deviceUC.RotateToken(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, d)
+}
+
+func (con *controller) activate(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	d, err := con.deviceUC.Activate(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, d)
+}
+
+func (con *controller) deactivate(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	d, err := con.deviceUC.Deactivate(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, d)
+}
+
+func (con *controller) delete(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := con.deviceUC.Delete(c.Request().Context(), id); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func parseID(c echo.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, httperrors.New(httperrors.InvalidArgument, "Invalid device id")
+	}
+	return id, nil
+}
+
+func validationError(err error) error {
+	e := httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
+	for _, s := range validate.SplitErrors(err) {
+		e.AddDetail(s)
+	}
+	return e
+}
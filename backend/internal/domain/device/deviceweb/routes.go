@@ -0,0 +1,29 @@
+package deviceweb
+
+import (
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator"
+	"github.com/antoniosarro/saint-tracker/backend/internal/web"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+)
+
+type Options struct {
+	Log           *logger.Log
+	DeviceUseCase iUseCase
+}
+
+func Route(web *web.Web, opts *Options) {
+	con := newController(opts.DeviceUseCase, opts.Log)
+
+	viewer := web.Mid.RequireRole(operator.RoleViewer)
+	admin := web.Mid.RequireRole(operator.RoleAdmin)
+
+	g := web.Echo.Group("/api/v1/devices")
+	g.GET("", con.list, viewer)
+	g.GET("/:id", con.get, viewer)
+	g.POST("", con.create, admin)
+	g.PUT("/:id", con.update, admin)
+	g.POST("/:id/rotate-token", con.rotateToken, admin)
+	g.POST("/:id/activate", con.activate, admin)
+	g.POST("/:id/deactivate", con.deactivate, admin)
+	g.DELETE("/:id", con.delete, admin)
+}
@@ -3,17 +3,57 @@ package device
 import (
 	"time"
 
-	"github.com/google/uuid"
+	validation "github.com/go-ozzo/ozzo-validation"
 )
 
 type DeviceDTO struct {
-	ID           uuid.UUID `db:"id"`
-	SerialNumber string    `db:"serial_number"`
-	Token        string    `db:"serial"`
-	DeviceName   string    `db:"device_name"`
-	IsActive     bool      `db:"is_active"`
-	CreatedAt    time.Time `db:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at"`
-	LastSeen     time.Time `db:"last_seen"`
-	Notes        string    `db:"notes"`
+	ID                     int64      `db:"id" json:"id"`
+	SerialNumber           string     `db:"serial_number" json:"serial_number"`
+	Token                  string     `db:"token" json:"-"`
+	PreviousToken          string     `db:"previous_token" json:"-"`
+	PreviousTokenExpiresAt *time.Time `db:"previous_token_expires_at" json:"previous_token_expires_at,omitempty"`
+	FrameKey               string     `db:"frame_key" json:"-"`
+	PreviousFrameKey       string     `db:"previous_frame_key" json:"-"`
+	DeviceName             string     `db:"device_name" json:"device_name"`
+	IsActive               bool       `db:"is_active" json:"is_active"`
+	CreatedAt              time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt              time.Time  `db:"update_at" json:"updated_at"`
+	LastSeen               *time.Time `db:"last_seen" json:"last_seen"`
+	LastSeenAgo            *int64     `db:"-" json:"last_seen_ago_seconds"`
+	Notes                  string     `db:"notes" json:"notes"`
+}
+
+// DeviceTokenDTO is returned only when a token is issued, it is the single
+// time the plain token leaves the server since only its hash is stored.
+type DeviceTokenDTO struct {
+	*DeviceDTO
+	Token string `json:"token"`
+}
+
+type NewDeviceDTO struct {
+	SerialNumber string `json:"serial_number"`
+	DeviceName   string `json:"device_name"`
+	Notes        string `json:"notes"`
+}
+
+func (d NewDeviceDTO) Validate() error {
+	return validation.ValidateStruct(
+		&d,
+		validation.Field(&d.SerialNumber, validation.Required, validation.Length(1, 64)),
+		validation.Field(&d.DeviceName, validation.Length(0, 100)),
+		validation.Field(&d.Notes, validation.Length(0, 2000)),
+	)
+}
+
+type UpdateDeviceDTO struct {
+	DeviceName string `json:"device_name"`
+	Notes      string `json:"notes"`
+}
+
+func (d UpdateDeviceDTO) Validate() error {
+	return validation.ValidateStruct(
+		&d,
+		validation.Field(&d.DeviceName, validation.Length(0, 100)),
+		validation.Field(&d.Notes, validation.Length(0, 2000)),
+	)
 }
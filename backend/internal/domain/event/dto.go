@@ -0,0 +1,126 @@
+package event
+
+import (
+	"errors"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/validate"
+	"github.com/google/uuid"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// Event lifecycle states
+const (
+	StatusScheduled = "scheduled"
+	StatusActive    = "active"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+)
+
+type EventDTO struct {
+	ID             uuid.UUID  `db:"id" json:"id"`
+	Name           string     `db:"name" json:"name"`
+	Saint          string     `db:"saint" json:"saint"`
+	Town           string     `db:"town" json:"town"`
+	ScheduledStart time.Time  `db:"scheduled_start" json:"scheduled_start"`
+	ScheduledEnd   time.Time  `db:"scheduled_end" json:"scheduled_end"`
+	Status         string     `db:"status" json:"status"`
+	StartedAt      *time.Time `db:"started_at" json:"started_at,omitempty"`
+	EndedAt        *time.Time `db:"ended_at" json:"ended_at,omitempty"`
+	Bounds         *Bounds    `db:"-" json:"bounds,omitempty"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+type NewEventDTO struct {
+	Name           string  `json:"name"`
+	Saint          string  `json:"saint"`
+	Town           string  `json:"town"`
+	ScheduledStart int64   `json:"scheduled_start"`
+	ScheduledEnd   int64   `json:"scheduled_end"`
+	Bounds         *Bounds `json:"bounds,omitempty"`
+}
+
+func (e NewEventDTO) Validate() error {
+	return validation.ValidateStruct(
+		&e,
+		validation.Field(&e.Name, validation.Required, validation.Length(1, 150)),
+		validation.Field(&e.Saint, validation.Required, validation.Length(1, 100)),
+		validation.Field(&e.Town, validation.Length(0, 100)),
+		validation.Field(&e.ScheduledStart, validation.Required, validate.Timestamp),
+		validation.Field(&e.ScheduledEnd, validation.Required, validate.Timestamp, validation.By(func(value interface{}) error {
+			if end, ok := value.(int64); ok && end <= e.ScheduledStart {
+				return errors.New("must be after scheduled_start")
+			}
+			return nil
+		})),
+		validation.Field(&e.Bounds),
+	)
+}
+
+// Bounds is the area an event takes place in, points received outside of
+// it are flagged as bad fixes
+type Bounds struct {
+	South float64 `json:"south"`
+	West  float64 `json:"west"`
+	North float64 `json:"north"`
+	East  float64 `json:"east"`
+}
+
+func (b Bounds) Validate() error {
+	return validation.ValidateStruct(
+		&b,
+		validation.Field(&b.South, validation.Min(-90.0), validation.Max(90.0)),
+		validation.Field(&b.North, validation.Min(-90.0), validation.Max(90.0), validation.By(func(value interface{}) error {
+			if north, ok := value.(float64); ok && north <= b.South {
+				return errors.New("must be north of south")
+			}
+			return nil
+		})),
+		validation.Field(&b.West, validation.Min(-180.0), validation.Max(180.0)),
+		validation.Field(&b.East, validation.Min(-180.0), validation.Max(180.0), validation.By(func(value interface{}) error {
+			if east, ok := value.(float64); ok && east <= b.West {
+				return errors.New("must be east of west")
+			}
+			return nil
+		})),
+	)
+}
+
+// Contains reports whether the point lies within the bounds
+func (b *Bounds) Contains(latitude, longitude float64) bool {
+	return latitude >= b.South && latitude <= b.North && longitude >= b.West && longitude <= b.East
+}
+
+// DeviceStatsDTO are the trip statistics of the track sent by one tracker.
+// Distances are in meters, speeds in km/h and durations in seconds.
+// AvgSpeed averages the speeds reported by the tracker while moving,
+// AvgMovingSpeed is derived from the distance covered over the moving time.
+type DeviceStatsDTO struct {
+	DeviceID              string     `json:"device_id"`
+	Points                int        `json:"points"`
+	FirstPointAt          *time.Time `json:"first_point_at"`
+	LastPointAt           *time.Time `json:"last_point_at"`
+	Distance              float64    `json:"distance"`
+	MaxSpeed              float64    `json:"max_speed"`
+	AvgSpeed              float64    `json:"avg_speed"`
+	AvgMovingSpeed        float64    `json:"avg_moving_speed"`
+	Duration              int64      `json:"duration"`
+	MovingTime            int64      `json:"moving_time"`
+	StoppedTime           int64      `json:"stopped_time"`
+	DistanceSinceLastStop float64    `json:"distance_since_last_stop"`
+}
+
+// StatsDTO are the trip statistics of an event. The trackers of an event
+// travel at different places of the procession, their tracks are measured
+// separately and listed in Devices. The top level figures are
+// those of the primary tracker, the one that sent the most points, named by
+// DeviceID.
+type StatsDTO struct {
+	EventID uuid.UUID `json:"event_id"`
+	DeviceStatsDTO
+	LastStop           string            `json:"last_stop,omitempty"`
+	LastStopDepartedAt *time.Time        `json:"last_stop_departed_at,omitempty"`
+	Devices            []*DeviceStatsDTO `json:"devices"`
+}
@@ -0,0 +1,90 @@
+package eventrepo
+
+import (
+	"context"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const columns = `id, name, saint, town, scheduled_start, scheduled_end, status, started_at, ended_at, area_south, area_west, area_north, area_east, created_at, updated_at`
+
+type repository struct {
+	*sqlx.DB
+}
+
+func NewDB(db *sqlx.DB) *repository {
+	return &repository{db}
+}
+
+func (dbrepo *repository) GetList(ctx context.Context) ([]*event.EventDTO, error) {
+	var models []*Model
+	query := `SELECT ` + columns + ` FROM event ORDER BY scheduled_start DESC`
+
+	if err := dbrepo.SelectContext(ctx, &models, query); err != nil {
+		return nil, err
+	}
+
+	dtos := make([]*event.EventDTO, 0, len(models))
+	for _, model := range models {
+		dtos = append(dtos, model.intoDTO())
+	}
+	return dtos, nil
+}
+
+func (dbrepo *repository) GetByID(ctx context.Context, id uuid.UUID) (*event.EventDTO, error) {
+	model := new(Model)
+	query := `SELECT ` + columns + ` FROM event WHERE id = $1`
+
+	if err := dbrepo.GetContext(ctx, model, query, id); err != nil {
+		return nil, err
+	}
+	return model.intoDTO(), nil
+}
+
+// GetActive returns the event currently in progress, sql.ErrNoRows if none.
+func (dbrepo *repository) GetActive(ctx context.Context) (*event.EventDTO, error) {
+	model := new(Model)
+	query := `SELECT ` + columns + ` FROM event WHERE status = $1 ORDER BY started_at DESC LIMIT 1`
+
+	if err := dbrepo.GetContext(ctx, model, query, event.StatusActive); err != nil {
+		return nil, err
+	}
+	return model.intoDTO(), nil
+}
+
+func (dbrepo *repository) Create(ctx context.Context, e *event.EventDTO) error {
+	query := `
+		INSERT INTO event
+			(id, name, saint, town, scheduled_start, scheduled_end, status, area_south, area_west, area_north, area_east, created_at, updated_at)
+		VALUES
+			(:id, :name, :saint, :town, :scheduled_start, :scheduled_end, :status, :area_south, :area_west, :area_north, :area_east, :created_at, :updated_at)
+	`
+
+	_, err := dbrepo.NamedExecContext(ctx, query, intoModel(e))
+	return err
+}
+
+func (dbrepo *repository) Update(ctx context.Context, e *event.EventDTO) error {
+	query := `
+		UPDATE event SET
+			name = :name,
+			saint = :saint,
+			town = :town,
+			scheduled_start = :scheduled_start,
+			scheduled_end = :scheduled_end,
+			status = :status,
+			started_at = :started_at,
+			ended_at = :ended_at,
+			area_south = :area_south,
+			area_west = :area_west,
+			area_north = :area_north,
+			area_east = :area_east,
+			updated_at = :updated_at
+		WHERE id = :id
+	`
+
+	_, err := dbrepo.NamedExecContext(ctx, query, intoModel(e))
+	return err
+}
@@ -0,0 +1,83 @@
+package eventrepo
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event"
+	"github.com/google/uuid"
+)
+
+type Model struct {
+	ID             uuid.UUID       `db:"id"`
+	Name           string          `db:"name"`
+	Saint          string          `db:"saint"`
+	Town           string          `db:"town"`
+	ScheduledStart time.Time       `db:"scheduled_start"`
+	ScheduledEnd   time.Time       `db:"scheduled_end"`
+	Status         string          `db:"status"`
+	StartedAt      sql.NullTime    `db:"started_at"`
+	EndedAt        sql.NullTime    `db:"ended_at"`
+	AreaSouth      sql.NullFloat64 `db:"area_south"`
+	AreaWest       sql.NullFloat64 `db:"area_west"`
+	AreaNorth      sql.NullFloat64 `db:"area_north"`
+	AreaEast       sql.NullFloat64 `db:"area_east"`
+	CreatedAt      time.Time       `db:"created_at"`
+	UpdatedAt      time.Time       `db:"updated_at"`
+}
+
+func (m *Model) intoDTO() *event.EventDTO {
+	dto := &event.EventDTO{
+		ID:             m.ID,
+		Name:           m.Name,
+		Saint:          m.Saint,
+		Town:           m.Town,
+		ScheduledStart: m.ScheduledStart,
+		ScheduledEnd:   m.ScheduledEnd,
+		Status:         m.Status,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+	if m.StartedAt.Valid {
+		dto.StartedAt = &m.StartedAt.Time
+	}
+	if m.EndedAt.Valid {
+		dto.EndedAt = &m.EndedAt.Time
+	}
+	if m.AreaSouth.Valid && m.AreaWest.Valid && m.AreaNorth.Valid && m.AreaEast.Valid {
+		dto.Bounds = &event.Bounds{
+			South: m.AreaSouth.Float64,
+			West:  m.AreaWest.Float64,
+			North: m.AreaNorth.Float64,
+			East:  m.AreaEast.Float64,
+		}
+	}
+	return dto
+}
+
+func intoModel(e *event.EventDTO) *Model {
+	m := &Model{
+		ID:             e.ID,
+		Name:           e.Name,
+		Saint:          e.Saint,
+		Town:           e.Town,
+		ScheduledStart: e.ScheduledStart,
+		ScheduledEnd:   e.ScheduledEnd,
+		Status:         e.Status,
+		CreatedAt:      e.CreatedAt,
+		UpdatedAt:      e.UpdatedAt,
+	}
+	if e.StartedAt != nil {
+		m.StartedAt = sql.NullTime{Time: *e.StartedAt, Valid: true}
+	}
+	if e.EndedAt != nil {
+		m.EndedAt = sql.NullTime{Time: *e.EndedAt, Valid: true}
+	}
+	if e.Bounds != nil {
+		m.AreaSouth = sql.NullFloat64{Float64: e.Bounds.South, Valid: true}
+		m.AreaWest = sql.NullFloat64{Float64: e.Bounds.West, Valid: true}
+		m.AreaNorth = sql.NullFloat64{Float64: e.Bounds.North, Valid: true}
+		m.AreaEast = sql.NullFloat64{Float64: e.Bounds.East, Valid: true}
+	}
+	return m
+}
@@ -0,0 +1,181 @@
+package eventuc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/config"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/db"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type iDBRepository interface {
+	GetList(ctx context.Context) ([]*event.EventDTO, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*event.EventDTO, error)
+	GetActive(ctx context.Context) (*event.EventDTO, error)
+	Create(ctx context.Context, e *event.EventDTO) error
+	Update(ctx context.Context, e *event.EventDTO) error
+}
+
+type UseCase struct {
+	conf   *config.Config
+	log    *logger.Log
+	dbRepo iDBRepository
+}
+
+func New(conf *config.Config, log *logger.Log, dbRepo iDBRepository) *UseCase {
+	return &UseCase{
+		conf:   conf,
+		log:    log,
+		dbRepo: dbRepo,
+	}
+}
+
+func (uc *UseCase) GetList(ctx context.Context) ([]*event.EventDTO, error) {
+	res, err := uc.dbRepo.GetList(ctx)
+	if err != nil {
+		uc.log.Errorf("event list error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve events data from db")
+	}
+	return res, nil
+}
+
+func (uc *UseCase) Get(ctx context.Context, id uuid.UUID) (*event.EventDTO, error) {
+	res, err := uc.dbRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperrors.New(httperrors.NotFound, "Event not found")
+		}
+		uc.log.Errorf("event get error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve event data from db")
+	}
+	return res, nil
+}
+
+func (uc *UseCase) GetActive(ctx context.Context) (*event.EventDTO, error) {
+	res, err := uc.dbRepo.GetActive(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperrors.New(httperrors.NotFound, "No active event")
+		}
+		uc.log.Errorf("event get active error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve event data from db")
+	}
+	return res, nil
+}
+
+func (uc *UseCase) Create(ctx context.Context, ec *event.NewEventDTO) (*event.EventDTO, error) {
+	now := time.Now().UTC()
+	e := &event.EventDTO{
+		ID:             uuid.New(),
+		Name:           ec.Name,
+		Saint:          ec.Saint,
+		Town:           ec.Town,
+		ScheduledStart: time.Unix(ec.ScheduledStart, 0).UTC(),
+		ScheduledEnd:   time.Unix(ec.ScheduledEnd, 0).UTC(),
+		Bounds:         ec.Bounds,
+		Status:         event.StatusScheduled,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	if err := uc.dbRepo.Create(ctx, e); err != nil {
+		uc.log.Errorf("event create error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Error inserting event")
+	}
+	return e, nil
+}
+
+func (uc *UseCase) Update(ctx context.Context, id uuid.UUID, ec *event.NewEventDTO) (*event.EventDTO, error) {
+	e, err := uc.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Name = ec.Name
+	e.Saint = ec.Saint
+	e.Town = ec.Town
+	e.ScheduledStart = time.Unix(ec.ScheduledStart, 0).UTC()
+	e.ScheduledEnd = time.Unix(ec.ScheduledEnd, 0).UTC()
+	e.Bounds = ec.Bounds
+
+	return e, uc.save(ctx, e)
+}
+
+// Start marks the event as the active one. Only one event can be active at
+// a time, since devices post into whichever event is currently active.
+func (uc *UseCase) Start(ctx context.Context, id uuid.UUID) (*event.EventDTO, error) {
+	e, err := uc.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Status != event.StatusScheduled {
+		return nil, httperrors.New(httperrors.FailedPrecondition, fmt.Sprintf("Event is %s, only scheduled events can be started", e.Status))
+	}
+
+	active, err := uc.dbRepo.GetActive(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		uc.log.Errorf("event get active error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve event data from db")
+	}
+	if active != nil {
+		herr := httperrors.New(httperrors.FailedPrecondition, "Another event is already active")
+		herr.AddDetail(fmt.Sprintf("active_event: %s", active.ID))
+		return nil, herr
+	}
+
+	now := time.Now().UTC()
+	e.Status = event.StatusActive
+	e.StartedAt = &now
+	e.UpdatedAt = now
+
+	// The check above can race with another start, the unique index on the
+	// active status settles it
+	if err := uc.dbRepo.Update(ctx, e); err != nil {
+		if db.IsUniqueViolation(err) {
+			return nil, httperrors.New(httperrors.FailedPrecondition, "Another event is already active")
+		}
+		uc.log.Errorf("event update error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Error updating event")
+	}
+	return e, nil
+}
+
+func (uc *UseCase) Complete(ctx context.Context, id uuid.UUID) (*event.EventDTO, error) {
+	return uc.finish(ctx, id, event.StatusCompleted)
+}
+
+func (uc *UseCase) Cancel(ctx context.Context, id uuid.UUID) (*event.EventDTO, error) {
+	return uc.finish(ctx, id, event.StatusCancelled)
+}
+
+func (uc *UseCase) finish(ctx context.Context, id uuid.UUID, status string) (*event.EventDTO, error) {
+	e, err := uc.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Status == event.StatusCompleted || e.Status == event.StatusCancelled {
+		return nil, httperrors.New(httperrors.FailedPrecondition, fmt.Sprintf("Event is already %s", e.Status))
+	}
+
+	now := time.Now().UTC()
+	e.Status = status
+	e.EndedAt = &now
+
+	return e, uc.save(ctx, e)
+}
+
+func (uc *UseCase) save(ctx context.Context, e *event.EventDTO) error {
+	e.UpdatedAt = time.Now().UTC()
+	if err := uc.dbRepo.Update(ctx, e); err != nil {
+		uc.log.Errorf("event update error, %v", err)
+		return httperrors.New(httperrors.Internal, "Error updating event")
+	}
+	return nil
+}
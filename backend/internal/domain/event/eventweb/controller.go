@@ -0,0 +1,161 @@
+package eventweb
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/validate"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type iUseCase interface {
+	GetList(ctx context.Context) ([]*event.EventDTO, error)
+	Get(ctx context.Context, id uuid.UUID) (*event.EventDTO, error)
+	GetActive(ctx context.Context) (*event.EventDTO, error)
+	Create(ctx context.Context, ec *event.NewEventDTO) (*event.EventDTO, error)
+	Update(ctx context.Context, id uuid.UUID, ec *event.NewEventDTO) (*event.EventDTO, error)
+	Start(ctx context.Context, id uuid.UUID) (*event.EventDTO, error)
+	Complete(ctx context.Context, id uuid.UUID) (*event.EventDTO, error)
+	Cancel(ctx context.Context, id uuid.UUID) (*event.EventDTO, error)
+}
+
+// iStatsUseCase computes the trip statistics over the stored track
+type iStatsUseCase interface {
+	GetStats(ctx context.Context, eventID uuid.UUID) (*event.StatsDTO, error)
+}
+
+type controller struct {
+	eventUC iUseCase
+	statsUC iStatsUseCase
+	log     *logger.Log
+}
+
+func newController(eventUC iUseCase, statsUC iStatsUseCase, log *logger.Log) *controller {
+	return &controller{eventUC, statsUC, log}
+}
+
+func (con *controller) list(c echo.Context) error {
+	e, err := con.eventUC.GetList(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, e)
+}
+
+func (con *controller) active(c echo.Context) error {
+	e, err := con.eventUC.GetActive(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, e)
+}
+
+func (con *controller) get(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	e, err := con.eventUC.Get(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, e)
+}
+
+func (con *controller) stats(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	s, err := con.statsUC.GetStats(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, s)
+}
+
+func (con *controller) create(c echo.Context) error {
+	dto, err := bindEvent(c)
+	if err != nil {
+		return err
+	}
+
+	e, err := con.eventUC.Create(c.Request().Context(), dto)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, e)
+}
+
+func (con *controller) update(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	dto, err := bindEvent(c)
+	if err != nil {
+		return err
+	}
+
+	e, err := con.eventUC.Update(c.Request().Context(), id, dto)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, e)
+}
+
+func (con *controller) start(c echo.Context) error {
+	return con.transition(c, con.eventUC.Start)
+}
+
+func (con *controller) complete(c echo.Context) error {
+	return con.transition(c, con.eventUC.Complete)
+}
+
+func (con *controller) cancel(c echo.Context) error {
+	return con.transition(c, con.eventUC.Cancel)
+}
+
+func (con *controller) transition(c echo.Context, fn func(context.Context, uuid.UUID) (*event.EventDTO, error)) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	e, err := fn(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, e)
+}
+
+func parseID(c echo.Context) (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, httperrors.New(httperrors.InvalidArgument, "Invalid event id")
+	}
+	return id, nil
+}
+
+func bindEvent(c echo.Context) (*event.NewEventDTO, error) {
+	dto := new(event.NewEventDTO)
+	if err := c.Bind(dto); err != nil {
+		return nil, httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
+	}
+
+	if err := dto.Validate(); err != nil {
+		e := httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
+		for _, s := range validate.SplitErrors(err) {
+			e.AddDetail(s)
+		}
+		return nil, e
+	}
+	return dto, nil
+}
@@ -0,0 +1,30 @@
+package eventweb
+
+import (
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator"
+	"github.com/antoniosarro/saint-tracker/backend/internal/web"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+)
+
+type Options struct {
+	Log          *logger.Log
+	EventUseCase iUseCase
+	StatsUseCase iStatsUseCase
+}
+
+func Route(web *web.Web, opts *Options) {
+	con := newController(opts.EventUseCase, opts.StatsUseCase, opts.Log)
+
+	op := web.Mid.RequireRole(operator.RoleOperator)
+
+	g := web.Echo.Group("/api/v1/events")
+	g.GET("", con.list)
+	g.GET("/active", con.active)
+	g.GET("/:id", con.get)
+	g.GET("/:id/stats", con.stats)
+	g.POST("", con.create, op)
+	g.PUT("/:id", con.update, op)
+	g.POST("/:id/start", con.start, op)
+	g.POST("/:id/complete", con.complete, op)
+	g.POST("/:id/cancel", con.cancel, op)
+}
@@ -0,0 +1,102 @@
+package operator
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// Operator roles, from the most to the least privileged
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+
+var roleRank = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// HasRole reports whether role grants at least the permissions of required
+func HasRole(role, required string) bool {
+	return roleRank[role] > 0 && roleRank[role] >= roleRank[required]
+}
+
+type OperatorDTO struct {
+	ID           uuid.UUID  `db:"id" json:"id"`
+	Username     string     `db:"username" json:"username"`
+	PasswordHash string     `db:"password_hash" json:"-"`
+	Role         string     `db:"role" json:"role"`
+	IsActive     bool       `db:"is_active" json:"is_active"`
+	LastLogin    *time.Time `db:"last_login" json:"last_login"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// maxPasswordBytes is the longest password bcrypt hashes, in bytes
+const maxPasswordBytes = 72
+
+// passwordBytes checks the length of a password in bytes, which is what
+// bcrypt limits, unlike validation.Length that counts runes
+var passwordBytes = validation.By(func(value interface{}) error {
+	if password, ok := value.(string); ok && len(password) > maxPasswordBytes {
+		return errors.New("the length must be no more than 72 bytes")
+	}
+	return nil
+})
+
+type NewOperatorDTO struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+func (o NewOperatorDTO) Validate() error {
+	return validation.ValidateStruct(
+		&o,
+		validation.Field(&o.Username, validation.Required, validation.Length(3, 64)),
+		validation.Field(&o.Password, validation.Required, validation.Length(10, 0), passwordBytes),
+		validation.Field(&o.Role, validation.Required, validation.In(RoleAdmin, RoleOperator, RoleViewer)),
+	)
+}
+
+// UpdateOperatorDTO changes an operator, the password and the active flag
+// are left as they are when omitted
+type UpdateOperatorDTO struct {
+	Password string `json:"password"`
+	Role     string `json:"role"`
+	IsActive *bool  `json:"is_active"`
+}
+
+func (o UpdateOperatorDTO) Validate() error {
+	return validation.ValidateStruct(
+		&o,
+		validation.Field(&o.Password, validation.Length(10, 0), passwordBytes),
+		validation.Field(&o.Role, validation.Required, validation.In(RoleAdmin, RoleOperator, RoleViewer)),
+	)
+}
+
+type LoginDTO struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (l LoginDTO) Validate() error {
+	return validation.ValidateStruct(
+		&l,
+		validation.Field(&l.Username, validation.Required),
+		validation.Field(&l.Password, validation.Required),
+	)
+}
+
+type TokenDTO struct {
+	AccessToken string       `json:"access_token"`
+	TokenType   string       `json:"token_type"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+	Operator    *OperatorDTO `json:"operator"`
+}
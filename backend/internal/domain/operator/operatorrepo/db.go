@@ -0,0 +1,98 @@
+package operatorrepo
+
+import (
+	"context"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const columns = `id, username, password_hash, role, is_active, last_login, created_at, updated_at`
+
+type repository struct {
+	*sqlx.DB
+}
+
+func NewDB(db *sqlx.DB) *repository {
+	return &repository{db}
+}
+
+func (dbrepo *repository) GetList(ctx context.Context) ([]*operator.OperatorDTO, error) {
+	var models []*Model
+	query := `SELECT ` + columns + ` FROM operator ORDER BY username`
+
+	if err := dbrepo.SelectContext(ctx, &models, query); err != nil {
+		return nil, err
+	}
+
+	dtos := make([]*operator.OperatorDTO, 0, len(models))
+	for _, model := range models {
+		dtos = append(dtos, model.intoDTO())
+	}
+	return dtos, nil
+}
+
+func (dbrepo *repository) GetByID(ctx context.Context, id uuid.UUID) (*operator.OperatorDTO, error) {
+	model := new(Model)
+	query := `SELECT ` + columns + ` FROM operator WHERE id = $1`
+
+	if err := dbrepo.GetContext(ctx, model, query, id); err != nil {
+		return nil, err
+	}
+	return model.intoDTO(), nil
+}
+
+func (dbrepo *repository) GetByUsername(ctx context.Context, username string) (*operator.OperatorDTO, error) {
+	model := new(Model)
+	query := `SELECT ` + columns + ` FROM operator WHERE username = $1`
+
+	if err := dbrepo.GetContext(ctx, model, query, username); err != nil {
+		return nil, err
+	}
+	return model.intoDTO(), nil
+}
+
+func (dbrepo *repository) Count(ctx context.Context) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM operator`
+
+	if err := dbrepo.GetContext(ctx, &count, query); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (dbrepo *repository) Create(ctx context.Context, o *operator.OperatorDTO) error {
+	query := `
+		INSERT INTO operator
+			(id, username, password_hash, role, is_active, created_at, updated_at)
+		VALUES
+			(:id, :username, :password_hash, :role, :is_active, :created_at, :updated_at)
+	`
+
+	_, err := dbrepo.NamedExecContext(ctx, query, intoModel(o))
+	return err
+}
+
+func (dbrepo *repository) Update(ctx context.Context, o *operator.OperatorDTO) error {
+	query := `
+		UPDATE operator SET
+			password_hash = :password_hash,
+			role = :role,
+			is_active = :is_active,
+			last_login = :last_login,
+			updated_at = :updated_at
+		WHERE id = :id
+	`
+
+	_, err := dbrepo.NamedExecContext(ctx, query, intoModel(o))
+	return err
+}
+
+func (dbrepo *repository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM operator WHERE id = $1`
+
+	_, err := dbrepo.ExecContext(ctx, query, id)
+	return err
+}
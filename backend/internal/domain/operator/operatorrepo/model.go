@@ -0,0 +1,52 @@
+package operatorrepo
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator"
+	"github.com/google/uuid"
+)
+
+type Model struct {
+	ID           uuid.UUID    `db:"id"`
+	Username     string       `db:"username"`
+	PasswordHash string       `db:"password_hash"`
+	Role         string       `db:"role"`
+	IsActive     bool         `db:"is_active"`
+	LastLogin    sql.NullTime `db:"last_login"`
+	CreatedAt    time.Time    `db:"created_at"`
+	UpdatedAt    time.Time    `db:"updated_at"`
+}
+
+func (m *Model) intoDTO() *operator.OperatorDTO {
+	dto := &operator.OperatorDTO{
+		ID:           m.ID,
+		Username:     m.Username,
+		PasswordHash: m.PasswordHash,
+		Role:         m.Role,
+		IsActive:     m.IsActive,
+		CreatedAt:    m.CreatedAt,
+		UpdatedAt:    m.UpdatedAt,
+	}
+	if m.LastLogin.Valid {
+		dto.LastLogin = &m.LastLogin.Time
+	}
+	return dto
+}
+
+func intoModel(o *operator.OperatorDTO) *Model {
+	m := &Model{
+		ID:           o.ID,
+		Username:     o.Username,
+		PasswordHash: o.PasswordHash,
+		Role:         o.Role,
+		IsActive:     o.IsActive,
+		CreatedAt:    o.CreatedAt,
+		UpdatedAt:    o.UpdatedAt,
+	}
+	if o.LastLogin != nil {
+		m.LastLogin = sql.NullTime{Time: *o.LastLogin, Valid: true}
+	}
+	return m
+}
@@ -0,0 +1,235 @@
+package operatoruc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/config"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/jwtauth"
+	"github.com/antoniosarro/saint-tracker/backend/internal/web/webcontext"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/db"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against when the username does not exist, so that
+// failed logins take the same time whether or not the account exists
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("saint-tracker-dummy-password"), bcrypt.DefaultCost)
+
+type iDBRepository interface {
+	GetList(ctx context.Context) ([]*operator.OperatorDTO, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*operator.OperatorDTO, error)
+	GetByUsername(ctx context.Context, username string) (*operator.OperatorDTO, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, o *operator.OperatorDTO) error
+	Update(ctx context.Context, o *operator.OperatorDTO) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type UseCase struct {
+	conf   *config.Config
+	log    *logger.Log
+	dbRepo iDBRepository
+}
+
+func New(conf *config.Config, log *logger.Log, dbRepo iDBRepository) *UseCase {
+	return &UseCase{
+		conf:   conf,
+		log:    log,
+		dbRepo: dbRepo,
+	}
+}
+
+// EnsureAdmin creates the bootstrap admin account from the configuration
+// when no operator exists yet
+func (uc *UseCase) EnsureAdmin(ctx context.Context) error {
+	count, err := uc.dbRepo.Count(ctx)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if uc.conf.Auth.AdminPassword == "" {
+		uc.log.Warn("No operator accounts exist, set AUTH_ADMINPASSWORD to create the first admin")
+		return nil
+	}
+
+	_, err = uc.Create(ctx, &operator.NewOperatorDTO{
+		Username: uc.conf.Auth.AdminUsername,
+		Password: uc.conf.Auth.AdminPassword,
+		Role:     operator.RoleAdmin,
+	})
+	if err != nil {
+		return err
+	}
+	uc.log.Infof("created bootstrap admin %s", uc.conf.Auth.AdminUsername)
+	return nil
+}
+
+func (uc *UseCase) Login(ctx context.Context, l *operator.LoginDTO) (*operator.TokenDTO, error) {
+	o, err := uc.dbRepo.GetByUsername(ctx, l.Username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		uc.log.Errorf("operator login error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve operator data from db")
+	}
+
+	if o == nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(l.Password))
+		return nil, httperrors.New(httperrors.InvalidCredentials, "Invalid username or password")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(o.PasswordHash), []byte(l.Password)); err != nil {
+		return nil, httperrors.New(httperrors.InvalidCredentials, "Invalid username or password")
+	}
+	if !o.IsActive {
+		return nil, httperrors.New(httperrors.PermissionDenied, "Operator account is disabled")
+	}
+
+	token, expiresAt, err := jwtauth.Sign([]byte(uc.conf.Auth.JWTSecret), o.ID.String(), o.Username, o.Role, uc.conf.Auth.TokenTTL)
+	if err != nil {
+		uc.log.Errorf("operator token signing error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not issue access token")
+	}
+
+	now := time.Now().UTC()
+	o.LastLogin = &now
+	if _, err := uc.save(ctx, o); err != nil {
+		return nil, err
+	}
+
+	return &operator.TokenDTO{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresAt:   expiresAt,
+		Operator:    o,
+	}, nil
+}
+
+// Me returns the operator authenticated on the request
+func (uc *UseCase) Me(ctx context.Context) (*operator.OperatorDTO, error) {
+	current, ok := webcontext.GetOperator(ctx)
+	if !ok {
+		return nil, httperrors.New(httperrors.Unauthenticated, "Not authenticated")
+	}
+
+	id, err := uuid.Parse(current.ID)
+	if err != nil {
+		return nil, httperrors.New(httperrors.Unauthenticated, "Not authenticated")
+	}
+	return uc.Get(ctx, id)
+}
+
+func (uc *UseCase) GetList(ctx context.Context) ([]*operator.OperatorDTO, error) {
+	res, err := uc.dbRepo.GetList(ctx)
+	if err != nil {
+		uc.log.Errorf("operator list error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve operators data from db")
+	}
+	return res, nil
+}
+
+func (uc *UseCase) Get(ctx context.Context, id uuid.UUID) (*operator.OperatorDTO, error) {
+	res, err := uc.dbRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperrors.New(httperrors.NotFound, "Operator not found")
+		}
+		uc.log.Errorf("operator get error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve operator data from db")
+	}
+	return res, nil
+}
+
+func (uc *UseCase) Create(ctx context.Context, oc *operator.NewOperatorDTO) (*operator.OperatorDTO, error) {
+	hash, err := uc.hashPassword(oc.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	o := &operator.OperatorDTO{
+		ID:           uuid.New(),
+		Username:     oc.Username,
+		PasswordHash: hash,
+		Role:         oc.Role,
+		IsActive:     true,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if err := uc.dbRepo.Create(ctx, o); err != nil {
+		if db.IsUniqueViolation(err) {
+			return nil, httperrors.New(httperrors.AlreadyExists, "An operator with this username already exists")
+		}
+		uc.log.Errorf("operator create error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Error inserting operator")
+	}
+	return o, nil
+}
+
+func (uc *UseCase) Update(ctx context.Context, id uuid.UUID, ou *operator.UpdateOperatorDTO) (*operator.OperatorDTO, error) {
+	o, err := uc.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current, ok := webcontext.GetOperator(ctx); ok && current.ID == o.ID.String() {
+		if ou.Role != o.Role || (ou.IsActive != nil && !*ou.IsActive) {
+			return nil, httperrors.New(httperrors.FailedPrecondition, "Operators cannot change their own role or disable themselves")
+		}
+	}
+
+	if ou.Password != "" {
+		hash, err := uc.hashPassword(ou.Password)
+		if err != nil {
+			return nil, err
+		}
+		o.PasswordHash = hash
+	}
+	o.Role = ou.Role
+	if ou.IsActive != nil {
+		o.IsActive = *ou.IsActive
+	}
+
+	return uc.save(ctx, o)
+}
+
+func (uc *UseCase) Delete(ctx context.Context, id uuid.UUID) error {
+	if current, ok := webcontext.GetOperator(ctx); ok && current.ID == id.String() {
+		return httperrors.New(httperrors.FailedPrecondition, "Operators cannot delete themselves")
+	}
+
+	if _, err := uc.Get(ctx, id); err != nil {
+		return err
+	}
+
+	if err := uc.dbRepo.Delete(ctx, id); err != nil {
+		uc.log.Errorf("operator delete error, %v", err)
+		return httperrors.New(httperrors.Internal, "Error deleting operator")
+	}
+	return nil
+}
+
+func (uc *UseCase) save(ctx context.Context, o *operator.OperatorDTO) (*operator.OperatorDTO, error) {
+	o.UpdatedAt = time.Now().UTC()
+	if err := uc.dbRepo.Update(ctx, o); err != nil {
+		uc.log.Errorf("operator update error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Error updating operator")
+	}
+	return o, nil
+}
+
+func (uc *UseCase) hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		uc.log.Errorf("operator password hashing error, %v", err)
+		return "", httperrors.New(httperrors.Internal, "Could not hash password")
+	}
+	return string(hash), nil
+}
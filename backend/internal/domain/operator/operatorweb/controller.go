@@ -0,0 +1,142 @@
+package operatorweb
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/validate"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type iUseCase interface {
+	Login(ctx context.Context, l *operator.LoginDTO) (*operator.TokenDTO, error)
+	Me(ctx context.Context) (*operator.OperatorDTO, error)
+	GetList(ctx context.Context) ([]*operator.OperatorDTO, error)
+	Get(ctx context.Context, id uuid.UUID) (*operator.OperatorDTO, error)
+	Create(ctx context.Context, oc *operator.NewOperatorDTO) (*operator.OperatorDTO, error)
+	Update(ctx context.Context, id uuid.UUID, ou *operator.UpdateOperatorDTO) (*operator.OperatorDTO, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type controller struct {
+	operatorUC iUseCase
+	log        *logger.Log
+}
+
+func newController(operatorUC iUseCase, log *logger.Log) *controller {
+	return &controller{operatorUC, log}
+}
+
+func (con *controller) login(c echo.Context) error {
+	dto := new(operator.LoginDTO)
+	if err := c.Bind(dto); err != nil {
+		return httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
+	}
+	if err := dto.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	t, err := con.operatorUC.Login(c.Request().Context(), dto)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+func (con *controller) me(c echo.Context) error {
+	o, err := con.operatorUC.Me(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, o)
+}
+
+func (con *controller) list(c echo.Context) error {
+	o, err := con.operatorUC.GetList(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, o)
+}
+
+func (con *controller) get(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	o, err := con.operatorUC.Get(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, o)
+}
+
+func (con *controller) create(c echo.Context) error {
+	dto := new(operator.NewOperatorDTO)
+	if err := c.Bind(dto); err != nil {
+		return httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
+	}
+	if err := dto.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	o, err := con.operatorUC.Create(c.Request().Context(), dto)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, o)
+}
+
+func (con *controller) update(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	dto := new(operator.UpdateOperatorDTO)
+	if err := c.Bind(dto); err != nil {
+		return httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
+	}
+	if err := dto.Validate(); err != nil {
+		return validationError(err)
+	}
+
+	o, err := con.operatorUC.Update(c.Request().Context(), id, dto)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, o)
+}
+
+func (con *controller) delete(c echo.Context) error {
+	id, err := parseID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := con.operatorUC.Delete(c.Request().Context(), id); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func parseID(c echo.Context) (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, httperrors.New(httperrors.InvalidArgument, "Invalid operator id")
+	}
+	return id, nil
+}
+
+func validationError(err error) error {
+	e := httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
+	for _, s := range validate.SplitErrors(err) {
+		e.AddDetail(s)
+	}
+	return e
+}
@@ -0,0 +1,27 @@
+package operatorweb
+
+import (
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator"
+	"github.com/antoniosarro/saint-tracker/backend/internal/web"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+)
+
+type Options struct {
+	Log             *logger.Log
+	OperatorUseCase iUseCase
+}
+
+func Route(web *web.Web, opts *Options) {
+	con := newController(opts.OperatorUseCase, opts.Log)
+
+	a := web.Echo.Group("/api/v1/auth")
+	a.POST("/login", con.login)
+	a.GET("/me", con.me, web.Mid.RequireRole(operator.RoleViewer))
+
+	g := web.Echo.Group("/api/v1/operators", web.Mid.RequireRole(operator.RoleAdmin))
+	g.GET("", con.list)
+	g.GET("/:id", con.get)
+	g.POST("", con.create)
+	g.PUT("/:id", con.update)
+	g.DELETE("/:id", con.delete)
+}
@@ -0,0 +1,60 @@
+package stop
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// Stop states, a stop is pending until the procession arrives, then done
+// once it leaves after the minimum duration. Pending stops behind a done
+// one are marked skipped.
+const (
+	StatusPending = "pending"
+	StatusArrived = "arrived"
+	StatusDone    = "done"
+	StatusSkipped = "skipped"
+)
+
+type StopDTO struct {
+	ID         uuid.UUID  `db:"id" json:"id"`
+	EventID    uuid.UUID  `db:"event_id" json:"event_id"`
+	Letter     string     `db:"letter" json:"letter"`
+	Name       string     `db:"name" json:"name"`
+	Latitude   float64    `db:"latitude" json:"latitude"`
+	Longitude  float64    `db:"longitude" json:"longitude"`
+	Radius     float64    `db:"radius" json:"radius"`
+	VisitOrder int        `db:"visit_order" json:"visit_order"`
+	Status     string     `db:"status" json:"status"`
+	ArrivedAt  *time.Time `db:"arrived_at" json:"arrived_at"`
+	DepartedAt *time.Time `db:"departed_at" json:"departed_at"`
+	Duration   int64      `db:"duration" json:"duration"`
+	VisitSeq   *int       `db:"visit_seq" json:"visit_seq"`
+	IsNext     bool       `db:"-" json:"is_next"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// NewStopDTO plans a stop. A zero radius uses the configured default.
+type NewStopDTO struct {
+	Letter     string  `json:"letter"`
+	Name       string  `json:"name"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	Radius     float64 `json:"radius"`
+	VisitOrder int     `json:"visit_order"`
+}
+
+func (s NewStopDTO) Validate() error {
+	return validation.ValidateStruct(
+		&s,
+		validation.Field(&s.Letter, validation.Required, validation.Length(1, 8)),
+		validation.Field(&s.Name, validation.Required, validation.Length(1, 150)),
+		validation.Field(&s.Latitude, validation.Required, validation.Min(-90.0), validation.Max(90.0)),
+		validation.Field(&s.Longitude, validation.Required, validation.Min(-180.0), validation.Max(180.0)),
+		validation.Field(&s.Radius, validation.Min(0.0), validation.Max(1000.0)),
+		validation.Field(&s.VisitOrder, validation.Required, validation.Min(1)),
+	)
+}
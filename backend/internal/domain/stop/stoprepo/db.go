@@ -0,0 +1,86 @@
+package stoprepo
+
+import (
+	"context"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const columns = `id, event_id, letter, name, latitude, longitude, radius, visit_order, status, arrived_at, departed_at, duration, visit_seq, created_at, updated_at`
+
+type repository struct {
+	*sqlx.DB
+}
+
+func NewDB(db *sqlx.DB) *repository {
+	return &repository{db}
+}
+
+// GetList returns the stops of an event in their planned order
+func (dbrepo *repository) GetList(ctx context.Context, eventID uuid.UUID) ([]*stop.StopDTO, error) {
+	var models []*Model
+	query := `SELECT ` + columns + ` FROM stop WHERE event_id = $1 ORDER BY visit_order`
+
+	if err := dbrepo.SelectContext(ctx, &models, query, eventID); err != nil {
+		return nil, err
+	}
+
+	dtos := make([]*stop.StopDTO, 0, len(models))
+	for _, model := range models {
+		dtos = append(dtos, model.intoDTO())
+	}
+	return dtos, nil
+}
+
+func (dbrepo *repository) GetByID(ctx context.Context, id uuid.UUID) (*stop.StopDTO, error) {
+	model := new(Model)
+	query := `SELECT ` + columns + ` FROM stop WHERE id = $1`
+
+	if err := dbrepo.GetContext(ctx, model, query, id); err != nil {
+		return nil, err
+	}
+	return model.intoDTO(), nil
+}
+
+func (dbrepo *repository) Create(ctx context.Context, s *stop.StopDTO) error {
+	query := `
+		INSERT INTO stop
+			(id, event_id, letter, name, latitude, longitude, radius, visit_order, status, created_at, updated_at)
+		VALUES
+			(:id, :event_id, :letter, :name, :latitude, :longitude, :radius, :visit_order, :status, :created_at, :updated_at)
+	`
+
+	_, err := dbrepo.NamedExecContext(ctx, query, intoModel(s))
+	return err
+}
+
+func (dbrepo *repository) Update(ctx context.Context, s *stop.StopDTO) error {
+	query := `
+		UPDATE stop SET
+			letter = :letter,
+			name = :name,
+			latitude = :latitude,
+			longitude = :longitude,
+			radius = :radius,
+			visit_order = :visit_order,
+			status = :status,
+			arrived_at = :arrived_at,
+			departed_at = :departed_at,
+			duration = :duration,
+			visit_seq = :visit_seq,
+			updated_at = :updated_at
+		WHERE id = :id
+	`
+
+	_, err := dbrepo.NamedExecContext(ctx, query, intoModel(s))
+	return err
+}
+
+func (dbrepo *repository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM stop WHERE id = $1`
+
+	_, err := dbrepo.ExecContext(ctx, query, id)
+	return err
+}
@@ -0,0 +1,82 @@
+package stoprepo
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
+	"github.com/google/uuid"
+)
+
+type Model struct {
+	ID         uuid.UUID     `db:"id"`
+	EventID    uuid.UUID     `db:"event_id"`
+	Letter     string        `db:"letter"`
+	Name       string        `db:"name"`
+	Latitude   float64       `db:"latitude"`
+	Longitude  float64       `db:"longitude"`
+	Radius     float64       `db:"radius"`
+	VisitOrder int           `db:"visit_order"`
+	Status     string        `db:"status"`
+	ArrivedAt  sql.NullTime  `db:"arrived_at"`
+	DepartedAt sql.NullTime  `db:"departed_at"`
+	Duration   int64         `db:"duration"`
+	VisitSeq   sql.NullInt64 `db:"visit_seq"`
+	CreatedAt  time.Time     `db:"created_at"`
+	UpdatedAt  time.Time     `db:"updated_at"`
+}
+
+func (m *Model) intoDTO() *stop.StopDTO {
+	dto := &stop.StopDTO{
+		ID:         m.ID,
+		EventID:    m.EventID,
+		Letter:     m.Letter,
+		Name:       m.Name,
+		Latitude:   m.Latitude,
+		Longitude:  m.Longitude,
+		Radius:     m.Radius,
+		VisitOrder: m.VisitOrder,
+		Status:     m.Status,
+		Duration:   m.Duration,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}
+	if m.ArrivedAt.Valid {
+		dto.ArrivedAt = &m.ArrivedAt.Time
+	}
+	if m.DepartedAt.Valid {
+		dto.DepartedAt = &m.DepartedAt.Time
+	}
+	if m.VisitSeq.Valid {
+		seq := int(m.VisitSeq.Int64)
+		dto.VisitSeq = &seq
+	}
+	return dto
+}
+
+func intoModel(s *stop.StopDTO) *Model {
+	m := &Model{
+		ID:         s.ID,
+		EventID:    s.EventID,
+		Letter:     s.Letter,
+		Name:       s.Name,
+		Latitude:   s.Latitude,
+		Longitude:  s.Longitude,
+		Radius:     s.Radius,
+		VisitOrder: s.VisitOrder,
+		Status:     s.Status,
+		Duration:   s.Duration,
+		CreatedAt:  s.CreatedAt,
+		UpdatedAt:  s.UpdatedAt,
+	}
+	if s.ArrivedAt != nil {
+		m.ArrivedAt = sql.NullTime{Time: *s.ArrivedAt, Valid: true}
+	}
+	if s.DepartedAt != nil {
+		m.DepartedAt = sql.NullTime{Time: *s.DepartedAt, Valid: true}
+	}
+	if s.VisitSeq != nil {
+		m.VisitSeq = sql.NullInt64{Int64: int64(*s.VisitSeq), Valid: true}
+	}
+	return m
+}
@@ -0,0 +1,218 @@
+package stopuc
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/config"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/internal/websocket"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/geo"
+	"github.com/google/uuid"
+)
+
+// change is a stop transition to persist and broadcast, snapshot holds the
+// stop as it was right after the transition
+type change struct {
+	kind     string
+	stop     *stop.StopDTO
+	snapshot stop.StopDTO
+}
+
+// tracker is the stop detection state machine of an event, ported from the
+// StopTracker of the frontend
+type tracker struct {
+	stops    []*stop.StopDTO
+	current  *stop.StopDTO
+	visits   int
+	lastTime time.Time
+
+	// reentered is when the current stop, already done, was entered again.
+	// The new visit is only recorded once it lasts the minimum duration, a
+	// procession passing by leaves the first one untouched.
+	reentered *time.Time
+}
+
+func newTracker(stops []*stop.StopDTO) *tracker {
+	t := &tracker{stops: stops}
+	for _, s := range stops {
+		if s.Status == stop.StatusArrived {
+			t.current = s
+		}
+		if s.VisitSeq != nil && *s.VisitSeq > t.visits {
+			t.visits = *s.VisitSeq
+		}
+	}
+	return t
+}
+
+// Process runs the stop detection over freshly registered waypoints of an
+// event. Transitions are stored and broadcast, failures are only logged
+// since the waypoints themselves are already saved.
+func (uc *UseCase) Process(ctx context.Context, eventID uuid.UUID, waypoints []*waypoint.WaypointDTO) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	t, ok := uc.trackers[eventID]
+	if !ok {
+		stops, err := uc.dbRepo.GetList(ctx, eventID)
+		if err != nil {
+			uc.log.Errorf("stop list error, %v", err)
+			return
+		}
+		t = newTracker(stops)
+		uc.trackers[eventID] = t
+	}
+	if len(t.stops) == 0 {
+		return
+	}
+
+	sorted := make([]*waypoint.WaypointDTO, len(waypoints))
+	copy(sorted, waypoints)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	var changes []change
+	for _, w := range sorted {
+		// Points older than the last processed one, e.g. a late batch,
+		// would replay transitions out of order
+		if w.CreatedAt.Before(t.lastTime) {
+			continue
+		}
+		t.lastTime = w.CreatedAt
+
+		changes = append(changes, t.step(geo.Point{
+			Latitude:  w.Latitude,
+			Longitude: w.Longitude,
+			Time:      w.CreatedAt,
+		}, uc.conf)...)
+	}
+
+	saved := make(map[uuid.UUID]bool)
+	for i := len(changes) - 1; i >= 0; i-- {
+		s := changes[i].stop
+		if saved[s.ID] {
+			continue
+		}
+		saved[s.ID] = true
+
+		s.UpdatedAt = time.Now().UTC()
+		if err := uc.dbRepo.Update(ctx, s); err != nil {
+			uc.log.Errorf("stop update error, %v", err)
+			// Reload from the db on the next waypoint
+			delete(uc.trackers, eventID)
+			return
+		}
+	}
+
+	if uc.broadcaster == nil {
+		return
+	}
+	for i := range changes {
+		uc.broadcaster.BroadcastStop(changes[i].kind, &changes[i].snapshot)
+	}
+}
+
+// step feeds a single position and returns the resulting transitions
+func (t *tracker) step(p geo.Point, conf *config.Config) []change {
+	var changes []change
+	record := func(kind string, s *stop.StopDTO) {
+		changes = append(changes, change{kind: kind, stop: s, snapshot: *s})
+	}
+
+	if t.current != nil {
+		s := t.current
+
+		exitRadius := conf.Stop.ExitRadius
+		if s.Radius > 0 {
+			exitRadius = s.Radius * 1.5
+		}
+
+		if t.reentered != nil {
+			if distanceTo(p, s) > exitRadius {
+				t.current = nil
+				t.reentered = nil
+			} else if p.Time.Sub(*t.reentered) >= conf.Stop.MinDuration {
+				t.arrive(s, *t.reentered)
+				t.reentered = nil
+				record(websocket.MessageTypeStopArrival, s)
+			}
+		} else if distanceTo(p, s) > exitRadius {
+			t.current = nil
+			duration := p.Time.Sub(*s.ArrivedAt)
+
+			if duration >= conf.Stop.MinDuration {
+				departedAt := p.Time
+				s.Status = stop.StatusDone
+				s.DepartedAt = &departedAt
+				s.Duration = int64(duration.Seconds())
+				record(websocket.MessageTypeStopDeparture, s)
+			} else {
+				// Too short to be a stop, the procession just passed by
+				s.Status = stop.StatusPending
+				s.ArrivedAt = nil
+				s.DepartedAt = nil
+				s.Duration = 0
+				s.VisitSeq = nil
+				record(websocket.MessageTypeStopReset, s)
+			}
+		}
+	} else {
+		// Completed stops can be entered again, only one stop at a time. A new
+		// visit of a done stop starts once it lasts the minimum duration.
+		for _, s := range t.stops {
+			radius := conf.Stop.DefaultRadius
+			if s.Radius > 0 {
+				radius = s.Radius
+			}
+			if distanceTo(p, s) > radius {
+				continue
+			}
+
+			t.current = s
+			if s.Status == stop.StatusDone {
+				reentered := p.Time
+				t.reentered = &reentered
+				break
+			}
+			t.arrive(s, p.Time)
+			record(websocket.MessageTypeStopArrival, s)
+			break
+		}
+	}
+
+	// Stops still pending before the last completed one were skipped
+	lastDone := 0
+	for _, s := range t.stops {
+		if s.Status == stop.StatusDone && s.VisitOrder > lastDone {
+			lastDone = s.VisitOrder
+		}
+	}
+	for _, s := range t.stops {
+		if s.Status == stop.StatusPending && s.VisitOrder < lastDone {
+			s.Status = stop.StatusSkipped
+			record(websocket.MessageTypeStopSkipped, s)
+		}
+	}
+
+	return changes
+}
+
+// arrive starts a new visit of a stop
+func (t *tracker) arrive(s *stop.StopDTO, arrivedAt time.Time) {
+	t.visits++
+	visitSeq := t.visits
+
+	s.Status = stop.StatusArrived
+	s.ArrivedAt = &arrivedAt
+	s.DepartedAt = nil
+	s.Duration = 0
+	s.VisitSeq = &visitSeq
+}
+
+func distanceTo(p geo.Point, s *stop.StopDTO) float64 {
+	return geo.Distance(p, geo.Point{Latitude: s.Latitude, Longitude: s.Longitude})
+}
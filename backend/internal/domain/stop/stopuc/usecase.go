@@ -0,0 +1,226 @@
+package stopuc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/config"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/antoniosarro/saint-tracker/backend/internal/websocket"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/db"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/google/uuid"
+)
+
+type iDBRepository interface {
+	GetList(ctx context.Context, eventID uuid.UUID) ([]*stop.StopDTO, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*stop.StopDTO, error)
+	Create(ctx context.Context, s *stop.StopDTO) error
+	Update(ctx context.Context, s *stop.StopDTO) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type iEventRepository interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*event.EventDTO, error)
+}
+
+type UseCase struct {
+	conf        *config.Config
+	log         *logger.Log
+	dbRepo      iDBRepository
+	eventRepo   iEventRepository
+	broadcaster websocket.Broadcaster
+
+	// trackers holds the stop detection state of each event, loaded from
+	// the db on the first waypoint and dropped whenever the plan changes.
+	// mu is held across plan changes too, so that they and the detection
+	// never overwrite each other's columns.
+	mu       sync.Mutex
+	trackers map[uuid.UUID]*tracker
+}
+
+func New(conf *config.Config, log *logger.Log, dbRepo iDBRepository, eventRepo iEventRepository, broadcaster websocket.Broadcaster) *UseCase {
+	return &UseCase{
+		conf:        conf,
+		log:         log,
+		dbRepo:      dbRepo,
+		eventRepo:   eventRepo,
+		broadcaster: broadcaster,
+		trackers:    make(map[uuid.UUID]*tracker),
+	}
+}
+
+// GetList returns the stops of an event in their planned order, flagging
+// the one the procession is expected to reach next
+func (uc *UseCase) GetList(ctx context.Context, eventID uuid.UUID) ([]*stop.StopDTO, error) {
+	if err := uc.checkEvent(ctx, eventID); err != nil {
+		return nil, err
+	}
+
+	res, err := uc.dbRepo.GetList(ctx, eventID)
+	if err != nil {
+		uc.log.Errorf("stop list error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve stops data from db")
+	}
+	markNext(res)
+	return res, nil
+}
+
+// LastStop returns the stop the procession is at, or else the one it left
+// last. It is nil before the first stop.
+func (uc *UseCase) LastStop(ctx context.Context, eventID uuid.UUID) (*stop.StopDTO, error) {
+	stops, err := uc.dbRepo.GetList(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	var last *stop.StopDTO
+	for _, s := range stops {
+		switch {
+		case s.Status == stop.StatusArrived:
+			return s, nil
+		case s.Status == stop.StatusDone && (last == nil || s.DepartedAt.After(*last.DepartedAt)):
+			last = s
+		}
+	}
+	return last, nil
+}
+
+func (uc *UseCase) Create(ctx context.Context, eventID uuid.UUID, sc *stop.NewStopDTO) (*stop.StopDTO, error) {
+	if err := uc.checkEvent(ctx, eventID); err != nil {
+		return nil, err
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	now := time.Now().UTC()
+	s := &stop.StopDTO{
+		ID:         uuid.New(),
+		EventID:    eventID,
+		Letter:     sc.Letter,
+		Name:       sc.Name,
+		Latitude:   sc.Latitude,
+		Longitude:  sc.Longitude,
+		Radius:     sc.Radius,
+		VisitOrder: sc.VisitOrder,
+		Status:     stop.StatusPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if err := uc.dbRepo.Create(ctx, s); err != nil {
+		if db.IsUniqueViolation(err) {
+			return nil, httperrors.New(httperrors.AlreadyExists, "A stop with this visit order already exists")
+		}
+		uc.log.Errorf("stop create error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Error inserting stop")
+	}
+
+	uc.invalidate(eventID)
+	return s, nil
+}
+
+func (uc *UseCase) Update(ctx context.Context, eventID, id uuid.UUID, sc *stop.NewStopDTO) (*stop.StopDTO, error) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	s, err := uc.get(ctx, eventID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Letter = sc.Letter
+	s.Name = sc.Name
+	s.Latitude = sc.Latitude
+	s.Longitude = sc.Longitude
+	s.Radius = sc.Radius
+	s.VisitOrder = sc.VisitOrder
+	s.UpdatedAt = time.Now().UTC()
+
+	if err := uc.dbRepo.Update(ctx, s); err != nil {
+		if db.IsUniqueViolation(err) {
+			return nil, httperrors.New(httperrors.AlreadyExists, "A stop with this visit order already exists")
+		}
+		uc.log.Errorf("stop update error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Error updating stop")
+	}
+
+	uc.invalidate(eventID)
+	return s, nil
+}
+
+func (uc *UseCase) Delete(ctx context.Context, eventID, id uuid.UUID) error {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if _, err := uc.get(ctx, eventID, id); err != nil {
+		return err
+	}
+
+	if err := uc.dbRepo.Delete(ctx, id); err != nil {
+		uc.log.Errorf("stop delete error, %v", err)
+		return httperrors.New(httperrors.Internal, "Error deleting stop")
+	}
+
+	uc.invalidate(eventID)
+	return nil
+}
+
+func (uc *UseCase) get(ctx context.Context, eventID, id uuid.UUID) (*stop.StopDTO, error) {
+	res, err := uc.dbRepo.GetByID(ctx, id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		uc.log.Errorf("stop get error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve stop data from db")
+	}
+	if res == nil || res.EventID != eventID {
+		return nil, httperrors.New(httperrors.NotFound, "Stop not found")
+	}
+	return res, nil
+}
+
+func (uc *UseCase) checkEvent(ctx context.Context, eventID uuid.UUID) error {
+	if _, err := uc.eventRepo.GetByID(ctx, eventID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return httperrors.New(httperrors.NotFound, "Event not found")
+		}
+		uc.log.Errorf("event get error, %v", err)
+		return httperrors.New(httperrors.Internal, "Could not retrieve event data from db")
+	}
+	return nil
+}
+
+// invalidate drops the detection state of the event so the next waypoint
+// reloads the updated plan. It must be called with mu held.
+func (uc *UseCase) invalidate(eventID uuid.UUID) {
+	delete(uc.trackers, eventID)
+}
+
+// markNext flags the next stop to visit: the first pending one, or the
+// first skipped one when none is pending. Nothing is flagged while the
+// procession is at a stop.
+func markNext(stops []*stop.StopDTO) {
+	var next *stop.StopDTO
+	for _, s := range stops {
+		switch s.Status {
+		case stop.StatusArrived:
+			return
+		case stop.StatusPending:
+			if next == nil || next.Status != stop.StatusPending {
+				next = s
+			}
+		case stop.StatusSkipped:
+			if next == nil {
+				next = s
+			}
+		}
+	}
+	if next != nil {
+		next.IsNext = true
+	}
+}
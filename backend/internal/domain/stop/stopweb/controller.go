@@ -0,0 +1,122 @@
+package stopweb
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/validate"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type iUseCase interface {
+	GetList(ctx context.Context, eventID uuid.UUID) ([]*stop.StopDTO, error)
+	Create(ctx context.Context, eventID uuid.UUID, sc *stop.NewStopDTO) (*stop.StopDTO, error)
+	Update(ctx context.Context, eventID, id uuid.UUID, sc *stop.NewStopDTO) (*stop.StopDTO, error)
+	Delete(ctx context.Context, eventID, id uuid.UUID) error
+}
+
+type controller struct {
+	stopUC iUseCase
+	log    *logger.Log
+}
+
+func newController(stopUC iUseCase, log *logger.Log) *controller {
+	return &controller{stopUC, log}
+}
+
+func (con *controller) list(c echo.Context) error {
+	eventID, err := parseID(c, "id", "Invalid event id")
+	if err != nil {
+		return err
+	}
+
+	s, err := con.stopUC.GetList(c.Request().Context(), eventID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, s)
+}
+
+func (con *controller) create(c echo.Context) error {
+	eventID, err := parseID(c, "id", "Invalid event id")
+	if err != nil {
+		return err
+	}
+
+	dto, err := bindStop(c)
+	if err != nil {
+		return err
+	}
+
+	s, err := con.stopUC.Create(c.Request().Context(), eventID, dto)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, s)
+}
+
+func (con *controller) update(c echo.Context) error {
+	eventID, err := parseID(c, "id", "Invalid event id")
+	if err != nil {
+		return err
+	}
+	id, err := parseID(c, "stopId", "Invalid stop id")
+	if err != nil {
+		return err
+	}
+
+	dto, err := bindStop(c)
+	if err != nil {
+		return err
+	}
+
+	s, err := con.stopUC.Update(c.Request().Context(), eventID, id, dto)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, s)
+}
+
+func (con *controller) delete(c echo.Context) error {
+	eventID, err := parseID(c, "id", "Invalid event id")
+	if err != nil {
+		return err
+	}
+	id, err := parseID(c, "stopId", "Invalid stop id")
+	if err != nil {
+		return err
+	}
+
+	if err := con.stopUC.Delete(c.Request().Context(), eventID, id); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func parseID(c echo.Context, param, message string) (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Param(param))
+	if err != nil {
+		return uuid.Nil, httperrors.New(httperrors.InvalidArgument, message)
+	}
+	return id, nil
+}
+
+func bindStop(c echo.Context) (*stop.NewStopDTO, error) {
+	dto := new(stop.NewStopDTO)
+	if err := c.Bind(dto); err != nil {
+		return nil, httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
+	}
+
+	if err := dto.Validate(); err != nil {
+		e := httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
+		for _, s := range validate.SplitErrors(err) {
+			e.AddDetail(s)
+		}
+		return nil, e
+	}
+	return dto, nil
+}
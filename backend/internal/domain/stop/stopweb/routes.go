@@ -0,0 +1,24 @@
+package stopweb
+
+import (
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator"
+	"github.com/antoniosarro/saint-tracker/backend/internal/web"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+)
+
+type Options struct {
+	Log         *logger.Log
+	StopUseCase iUseCase
+}
+
+func Route(web *web.Web, opts *Options) {
+	con := newController(opts.StopUseCase, opts.Log)
+
+	op := web.Mid.RequireRole(operator.RoleOperator)
+
+	g := web.Echo.Group("/api/v1/events/:id/stops")
+	g.GET("", con.list)
+	g.POST("", con.create, op)
+	g.PUT("/:stopId", con.update, op)
+	g.DELETE("/:stopId", con.delete, op)
+}
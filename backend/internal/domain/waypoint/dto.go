@@ -1,28 +1,90 @@
 package waypoint
 
 import (
+	"encoding/json"
 	"time"
 
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
 	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/validate"
 	"github.com/google/uuid"
 
 	validation "github.com/go-ozzo/ozzo-validation"
 )
 
+// WaypointDTO is a stored point. The GNSS fields are optional since not
+// every tracker reports them: altitude in meters above sea level, heading
+// in degrees clockwise from north, accuracy in meters.
 type WaypointDTO struct {
-	ID        uuid.UUID `db:"id" json:"id"`
-	Latitude  float32   `db:"latitude" json:"latitude"`
-	Longitude float32   `db:"longitude" json:"longitude"`
-	Speed     int       `db:"speed" json:"speed"`
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	ID          uuid.UUID  `db:"id" json:"id"`
+	EventID     *uuid.UUID `db:"event_id" json:"event_id,omitempty"`
+	Latitude    float64    `db:"latitude" json:"latitude"`
+	Longitude   float64    `db:"longitude" json:"longitude"`
+	Speed       int        `db:"speed" json:"speed"`
+	Altitude    *float64   `db:"altitude" json:"altitude,omitempty"`
+	Heading     *float64   `db:"heading" json:"heading,omitempty"`
+	HDOP        *float64   `db:"hdop" json:"hdop,omitempty"`
+	Satellites  *int       `db:"satellites" json:"satellites,omitempty"`
+	Accuracy    *float64   `db:"accuracy" json:"accuracy,omitempty"`
+	DeviceID    string     `db:"device_id" json:"device_id,omitempty"`
+	ClientID    string     `db:"client_id" json:"client_id,omitempty"`
+	QualityFlag string     `db:"quality_flag" json:"quality_flag,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updated_at"`
+
+	// Duplicate marks a point the tracker had already sent, the stored one
+	// is returned in its place
+	Duplicate bool `db:"-" json:"duplicate,omitempty"`
+	// Rejected marks a point refused by the quality filter, it was not
+	// stored
+	Rejected bool `db:"-" json:"rejected,omitempty"`
+}
+
+// Quality flags, why a point is considered a bad fix
+const (
+	QualityArea  = "area"
+	QualityHDOP  = "hdop"
+	QualitySpeed = "speed"
+)
+
+// PositionDTO is the smoothed position of a tracker, estimated from its
+// good fixes. Speed is in km/h, heading in degrees clockwise from north and
+// accuracy in meters.
+type PositionDTO struct {
+	DeviceID  string     `json:"device_id"`
+	EventID   *uuid.UUID `json:"event_id,omitempty"`
+	Latitude  float64    `json:"latitude"`
+	Longitude float64    `json:"longitude"`
+	Speed     float64    `json:"speed"`
+	Heading   float64    `json:"heading"`
+	Accuracy  float64    `json:"accuracy"`
+	FixedAt   time.Time  `json:"fixed_at"`
+}
+
+// SnapshotDTO is the live state of an event sent to the WebSocket clients
+// that ask for it on connect. LastEventID is the ID of the last broadcast
+// already reflected in it.
+type SnapshotDTO struct {
+	EventID     *uuid.UUID      `json:"event_id,omitempty"`
+	Positions   []*PositionDTO  `json:"positions"`
+	Track       *TrackDTO       `json:"track"`
+	Stops       []*stop.StopDTO `json:"stops"`
+	LastEventID uint64          `json:"-"`
 }
 
+// NewWaypointDTO is a point sent by a tracker. ClientID optionally
+// identifies the point on the tracker so that resending it is harmless,
+// without it a resent point is recognised by its timestamp.
 type NewWaypointDTO struct {
-	Latitude  float32 `json:"latitude"`
-	Longitude float32 `json:"longitude"`
-	Speed     int     `json:"speed"`
-	CreatedAt int64   `json:"created_at"`
+	Latitude   float64  `json:"latitude"`
+	Longitude  float64  `json:"longitude"`
+	Speed      int      `json:"speed"`
+	Altitude   *float64 `json:"altitude,omitempty"`
+	Heading    *float64 `json:"heading,omitempty"`
+	HDOP       *float64 `json:"hdop,omitempty"`
+	Satellites *int     `json:"satellites,omitempty"`
+	Accuracy   *float64 `json:"accuracy,omitempty"`
+	CreatedAt  int64    `json:"created_at"`
+	ClientID   string   `json:"client_id,omitempty"`
 }
 
 func (w NewWaypointDTO) Validate() error {
@@ -31,6 +93,91 @@ func (w NewWaypointDTO) Validate() error {
 		validation.Field(&w.Latitude, validation.Required, validation.Min(-90.0), validation.Max(90.0)),
 		validation.Field(&w.Longitude, validation.Required, validation.Min(-180.0), validation.Max(180.0)),
 		validation.Field(&w.Speed, validation.Min(0)),
+		validation.Field(&w.Altitude, validation.Min(-500.0), validation.Max(10000.0)),
+		validation.Field(&w.Heading, validation.Min(0.0), validation.Max(360.0)),
+		validation.Field(&w.HDOP, validation.Min(0.0), validation.Max(100.0)),
+		validation.Field(&w.Satellites, validation.Min(0), validation.Max(255)),
+		validation.Field(&w.Accuracy, validation.Min(0.0), validation.Max(100000.0)),
 		validation.Field(&w.CreatedAt, validation.Required, validate.Timestamp),
+		validation.Field(&w.ClientID, validation.Length(0, 64)),
+	)
+}
+
+// DecodeNewWaypoints reads the body sent by a tracker, either a single
+// waypoint or an array of them. The boolean reports whether it was an array.
+func DecodeNewWaypoints(body []byte) ([]*NewWaypointDTO, bool, error) {
+	var dtos []*NewWaypointDTO
+	if err := json.Unmarshal(body, &dtos); err == nil && len(dtos) > 0 {
+		return dtos, true, nil
+	}
+
+	dto := new(NewWaypointDTO)
+	if err := json.Unmarshal(body, dto); err != nil {
+		return nil, false, err
+	}
+	return []*NewWaypointDTO{dto}, false, nil
+}
+
+// MaxListLimit caps the page size of a waypoint listing
+const MaxListLimit = 5000
+
+// ListFilter narrows a waypoint listing. Results are always sorted by
+// created_at, ties broken by id, so that cursors are stable. SinceID and
+// SinceTime resume the listing right after the given waypoint or instant,
+// in the requested order. ExcludeFlagged leaves out the bad fixes.
+type ListFilter struct {
+	EventID        *uuid.UUID
+	From           *time.Time
+	To             *time.Time
+	SinceID        *uuid.UUID
+	SinceTime      *time.Time
+	Limit          int
+	Desc           bool
+	ExcludeFlagged bool
+}
+
+// Default track simplification parameters, the same the frontend filter used
+const (
+	DefaultTrackEpsilon         = 5.0
+	DefaultTrackMinDistance     = 10.0
+	DefaultTrackMinTimeInterval = 5
+	DefaultTrackMaxPoints       = 1000
+)
+
+// MaxTrackPoints caps the size of a simplified track
+const MaxTrackPoints = 20000
+
+// TrackOptions are the simplification parameters of a track. Distances are
+// in meters and MinTimeInterval is in seconds.
+type TrackOptions struct {
+	EventID         *uuid.UUID `json:"event_id"`
+	Epsilon         float64    `json:"epsilon"`
+	MinDistance     float64    `json:"minDistance"`
+	MinTimeInterval int        `json:"minTimeInterval"`
+	MaxPoints       int        `json:"maxPoints"`
+}
+
+func (o TrackOptions) Validate() error {
+	return validation.ValidateStruct(
+		&o,
+		validation.Field(&o.Epsilon, validation.Min(0.0), validation.Max(1000.0)),
+		validation.Field(&o.MinDistance, validation.Min(0.0), validation.Max(10000.0)),
+		validation.Field(&o.MinTimeInterval, validation.Min(0), validation.Max(3600)),
+		validation.Field(&o.MaxPoints, validation.Required, validation.Min(2), validation.Max(MaxTrackPoints)),
 	)
 }
+
+type TrackDTO struct {
+	EventID     *uuid.UUID     `json:"event_id,omitempty"`
+	TotalPoints int            `json:"total_points"`
+	Points      []*WaypointDTO `json:"points"`
+}
+
+// MatchedTrackDTO is the track of an event snapped onto the road network.
+// Each segment is a line of [latitude, longitude] pairs, the track of every
+// tracker is split where it cannot be followed along the roads.
+type MatchedTrackDTO struct {
+	EventID     *uuid.UUID     `json:"event_id,omitempty"`
+	TotalPoints int            `json:"total_points"`
+	Segments    [][][2]float64 `json:"segments"`
+}
@@ -0,0 +1,29 @@
+package waypoint
+
+import (
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
+	"github.com/google/uuid"
+)
+
+// ExportPageSize is how many waypoints an export reads from the db at once
+const ExportPageSize = 1000
+
+// ExportInfo describes what an export covers
+type ExportInfo struct {
+	EventID     *uuid.UUID
+	Name        string
+	Description string
+	From        *time.Time
+	To          *time.Time
+}
+
+// ExportWriter receives an export as it is read: Begin once validation is
+// over, then the stops of the event, then the waypoints in time order.
+type ExportWriter interface {
+	Begin(info *ExportInfo) error
+	WriteStop(s *stop.StopDTO) error
+	WritePoint(w *WaypointDTO) error
+	End() error
+}
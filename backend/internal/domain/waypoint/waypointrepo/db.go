@@ -2,11 +2,16 @@ package waypointrepo
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
+const columns = `id, event_id, latitude, longitude, speed, altitude, heading, hdop, satellites, accuracy, device_id, client_id, quality_flag, created_at, updated_at`
+
 type repository struct {
 	*sqlx.DB
 }
@@ -15,11 +20,11 @@ func NewDB(db *sqlx.DB) *repository {
 	return &repository{db}
 }
 
-func (dbrepo *repository) GetList(ctx context.Context) ([]*waypoint.WaypointDTO, error) {
+func (dbrepo *repository) GetList(ctx context.Context, filter *waypoint.ListFilter) ([]*waypoint.WaypointDTO, error) {
 	var models []*Model
-	query := `SELECT * FROM waypoint`
+	query, args := listQuery(filter)
 
-	rows, err := dbrepo.QueryxContext(ctx, query)
+	rows, err := dbrepo.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -42,6 +47,19 @@ func (dbrepo *repository) GetList(ctx context.Context) ([]*waypoint.WaypointDTO,
 	return dtos, nil
 }
 
+func (dbrepo *repository) GetByID(ctx context.Context, id uuid.UUID) (*waypoint.WaypointDTO, error) {
+	model := new(Model)
+	query := `SELECT ` + columns + ` FROM waypoint WHERE id = $1`
+
+	if err := dbrepo.GetContext(ctx, model, query, id); err != nil {
+		return nil, err
+	}
+	return model.intoDTO(), nil
+}
+
+// CreateBatch inserts the waypoints in a single transaction. A waypoint the
+// same device had already sent is not inserted again, it is replaced by the
+// stored one and marked as a duplicate.
 func (dbrepo *repository) CreateBatch(ctx context.Context, waypoints []*waypoint.WaypointDTO) error {
 	if len(waypoints) == 0 {
 		return nil
@@ -55,16 +73,119 @@ func (dbrepo *repository) CreateBatch(ctx context.Context, waypoints []*waypoint
 
 	query := `
 		INSERT INTO waypoint
-			(id, latitude, longitude, speed, created_at, updated_at)
+			(id, event_id, latitude, longitude, speed, altitude, heading, hdop, satellites, accuracy, device_id, client_id, quality_flag, created_at, updated_at)
 		VALUES
-			(:id, :latitude, :longitude, :speed, :created_at, :updated_at)
+			(:id, :event_id, :latitude, :longitude, :speed, :altitude, :heading, :hdop, :satellites, :accuracy, :device_id, :client_id, :quality_flag, :created_at, :updated_at)
+		ON CONFLICT DO NOTHING
 	`
 
 	for _, w := range waypoints {
-		if _, err := tx.NamedExecContext(ctx, query, intoModel(w)); err != nil {
+		res, err := tx.NamedExecContext(ctx, query, intoModel(w))
+		if err != nil {
 			return err
 		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+
+		stored, err := getDuplicate(ctx, tx, w)
+		if err != nil {
+			return err
+		}
+		*w = *stored
+		w.Duplicate = true
 	}
 
 	return tx.Commit()
 }
+
+// getDuplicate returns the stored waypoint that prevented w from being
+// inserted, matched the same way as the unique indexes
+func getDuplicate(ctx context.Context, tx *sqlx.Tx, w *waypoint.WaypointDTO) (*waypoint.WaypointDTO, error) {
+	model := new(Model)
+	var err error
+	if w.ClientID != "" {
+		query := `SELECT ` + columns + ` FROM waypoint WHERE device_id = $1 AND client_id = $2`
+		err = tx.GetContext(ctx, model, query, w.DeviceID, w.ClientID)
+	} else {
+		query := `SELECT ` + columns + ` FROM waypoint WHERE device_id = $1 AND client_id IS NULL AND created_at = $2`
+		err = tx.GetContext(ctx, model, query, w.DeviceID, w.CreatedAt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("waypoint conflict lookup, %w", err)
+	}
+	return model.intoDTO(), nil
+}
+
+// Delete removes the waypoint and reports whether it existed
+func (dbrepo *repository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `DELETE FROM waypoint WHERE id = $1`
+
+	res, err := dbrepo.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func listQuery(filter *waypoint.ListFilter) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.EventID != nil {
+		conds = append(conds, `event_id = `+arg(*filter.EventID))
+	}
+	if filter.ExcludeFlagged {
+		conds = append(conds, `quality_flag IS NULL`)
+	}
+	if filter.From != nil {
+		conds = append(conds, `created_at >= `+arg(filter.From.UTC()))
+	}
+	if filter.To != nil {
+		conds = append(conds, `created_at <= `+arg(filter.To.UTC()))
+	}
+
+	op := ">"
+	if filter.Desc {
+		op = "<"
+	}
+	if filter.SinceID != nil {
+		id := arg(*filter.SinceID)
+		conds = append(conds, fmt.Sprintf(`(created_at, id) %s ((SELECT created_at FROM waypoint WHERE id = %s), %s)`, op, id, id))
+	}
+	if filter.SinceTime != nil {
+		conds = append(conds, fmt.Sprintf(`created_at %s %s`, op, arg(filter.SinceTime.UTC())))
+	}
+
+	query := `SELECT ` + columns + ` FROM waypoint`
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, ` AND `)
+	}
+
+	if filter.Desc {
+		query += ` ORDER BY created_at DESC, id DESC`
+	} else {
+		query += ` ORDER BY created_at ASC, id ASC`
+	}
+
+	if filter.Limit > 0 {
+		query += ` LIMIT ` + arg(filter.Limit)
+	}
+
+	return query, args
+}
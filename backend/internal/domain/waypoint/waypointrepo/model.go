@@ -1,6 +1,7 @@
 package waypointrepo
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
@@ -8,31 +9,83 @@ import (
 )
 
 type Model struct {
-	ID        uuid.UUID `db:"id"`
-	Latitude  float32   `db:"latitude"`
-	Longitude float32   `db:"longitude"`
-	Speed     int       `db:"speed"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	ID          uuid.UUID       `db:"id"`
+	EventID     uuid.NullUUID   `db:"event_id"`
+	Latitude    float64         `db:"latitude"`
+	Longitude   float64         `db:"longitude"`
+	Speed       int             `db:"speed"`
+	Altitude    sql.NullFloat64 `db:"altitude"`
+	Heading     sql.NullFloat64 `db:"heading"`
+	HDOP        sql.NullFloat64 `db:"hdop"`
+	Satellites  sql.NullInt64   `db:"satellites"`
+	Accuracy    sql.NullFloat64 `db:"accuracy"`
+	DeviceID    sql.NullString  `db:"device_id"`
+	ClientID    sql.NullString  `db:"client_id"`
+	QualityFlag sql.NullString  `db:"quality_flag"`
+	CreatedAt   time.Time       `db:"created_at"`
+	UpdatedAt   time.Time       `db:"updated_at"`
 }
 
 func (m *Model) intoDTO() *waypoint.WaypointDTO {
-	return &waypoint.WaypointDTO{
-		ID:        m.ID,
-		Latitude:  m.Latitude,
-		Longitude: m.Longitude,
-		Speed:     m.Speed,
-		CreatedAt: m.CreatedAt,
-		UpdatedAt: m.UpdatedAt,
+	dto := &waypoint.WaypointDTO{
+		ID:          m.ID,
+		Latitude:    m.Latitude,
+		Longitude:   m.Longitude,
+		Speed:       m.Speed,
+		Altitude:    fromNullFloat(m.Altitude),
+		Heading:     fromNullFloat(m.Heading),
+		HDOP:        fromNullFloat(m.HDOP),
+		Accuracy:    fromNullFloat(m.Accuracy),
+		DeviceID:    m.DeviceID.String,
+		ClientID:    m.ClientID.String,
+		CreatedAt:   m.CreatedAt,
+		QualityFlag: m.QualityFlag.String,
+		UpdatedAt:   m.UpdatedAt,
 	}
+	if m.EventID.Valid {
+		dto.EventID = &m.EventID.UUID
+	}
+	if m.Satellites.Valid {
+		satellites := int(m.Satellites.Int64)
+		dto.Satellites = &satellites
+	}
+	return dto
 }
 
 func intoModel(w *waypoint.WaypointDTO) *Model {
-	return &Model{
-		ID:        w.ID,
-		Latitude:  w.Latitude,
-		Longitude: w.Longitude,
-		CreatedAt: w.CreatedAt,
-		Speed:     w.Speed,
+	m := &Model{
+		ID:          w.ID,
+		Latitude:    w.Latitude,
+		Longitude:   w.Longitude,
+		CreatedAt:   w.CreatedAt,
+		Speed:       w.Speed,
+		Altitude:    toNullFloat(w.Altitude),
+		Heading:     toNullFloat(w.Heading),
+		HDOP:        toNullFloat(w.HDOP),
+		Accuracy:    toNullFloat(w.Accuracy),
+		DeviceID:    sql.NullString{String: w.DeviceID, Valid: w.DeviceID != ""},
+		ClientID:    sql.NullString{String: w.ClientID, Valid: w.ClientID != ""},
+		QualityFlag: sql.NullString{String: w.QualityFlag, Valid: w.QualityFlag != ""},
+	}
+	if w.EventID != nil {
+		m.EventID = uuid.NullUUID{UUID: *w.EventID, Valid: true}
+	}
+	if w.Satellites != nil {
+		m.Satellites = sql.NullInt64{Int64: int64(*w.Satellites), Valid: true}
+	}
+	return m
+}
+
+func fromNullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+func toNullFloat(v *float64) sql.NullFloat64 {
+	if v == nil {
+		return sql.NullFloat64{}
 	}
+	return sql.NullFloat64{Float64: *v, Valid: true}
 }
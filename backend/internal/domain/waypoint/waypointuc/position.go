@@ -0,0 +1,117 @@
+package waypointuc
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/antoniosarro/saint-tracker/backend/config"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/geo"
+	"github.com/google/uuid"
+)
+
+// hdopAccuracy is the position error in meters per unit of HDOP, used for
+// the fixes that report no accuracy of their own
+const hdopAccuracy = 5.0
+
+// positionReplayPoints is how many of the latest good fixes are replayed
+// into the filters on startup
+const positionReplayPoints = 500
+
+// positionFilter keeps a Kalman filter per tracker over its good fixes, its
+// estimate is the live position shown on the map
+type positionFilter struct {
+	conf *config.Config
+
+	mu      sync.Mutex
+	devices map[string]*geo.Kalman
+	latest  map[string]*waypoint.PositionDTO
+}
+
+func newPositionFilter(conf *config.Config) *positionFilter {
+	return &positionFilter{
+		conf:    conf,
+		devices: make(map[string]*geo.Kalman),
+		latest:  make(map[string]*waypoint.PositionDTO),
+	}
+}
+
+// update feeds the good fixes of a tracker to its filter in time order and
+// returns the new position, nil when none of them was newer than the
+// current estimate
+func (f *positionFilter) update(deviceID string, waypoints []*waypoint.WaypointDTO) *waypoint.PositionDTO {
+	sorted := make([]*waypoint.WaypointDTO, len(waypoints))
+	copy(sorted, waypoints)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k, ok := f.devices[deviceID]
+	if !ok {
+		k = geo.NewKalman(f.conf.Position.Acceleration)
+		f.devices[deviceID] = k
+	}
+
+	var last *waypoint.WaypointDTO
+	for _, w := range sorted {
+		if _, ok := k.Update(fix(w)); ok {
+			last = w
+		}
+	}
+	if last == nil {
+		return nil
+	}
+
+	e := k.Estimate()
+	p := &waypoint.PositionDTO{
+		DeviceID:  deviceID,
+		EventID:   last.EventID,
+		Latitude:  e.Latitude,
+		Longitude: e.Longitude,
+		Speed:     e.Speed,
+		Heading:   e.Heading,
+		Accuracy:  e.Accuracy,
+		FixedAt:   e.Time,
+	}
+	f.latest[deviceID] = p
+	return p
+}
+
+// list returns the current positions of the trackers of an event sorted by
+// device, or of every tracker when eventID is nil
+func (f *positionFilter) list(eventID *uuid.UUID) []*waypoint.PositionDTO {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	res := make([]*waypoint.PositionDTO, 0, len(f.latest))
+	for _, p := range f.latest {
+		if eventID == nil || (p.EventID != nil && *p.EventID == *eventID) {
+			res = append(res, p)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].DeviceID < res[j].DeviceID
+	})
+	return res
+}
+
+// fix turns a waypoint into a filter measurement, trusting the reported
+// accuracy over the HDOP
+func fix(w *waypoint.WaypointDTO) geo.Fix {
+	speed := float64(w.Speed)
+	f := geo.Fix{
+		Point:   geo.Point{Latitude: w.Latitude, Longitude: w.Longitude, Time: w.CreatedAt},
+		Speed:   &speed,
+		Heading: w.Heading,
+	}
+	switch {
+	case w.Accuracy != nil:
+		f.Accuracy = *w.Accuracy
+	case w.HDOP != nil:
+		f.Accuracy = *w.HDOP * hdopAccuracy
+	}
+	return f
+}
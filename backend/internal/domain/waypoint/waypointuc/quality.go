@@ -0,0 +1,99 @@
+package waypointuc
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/config"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/geo"
+)
+
+// qualityFilter flags the bad fixes among the incoming points: outside the
+// event area, with a high HDOP, or too far from the previous good fix of
+// the same tracker for the time elapsed
+type qualityFilter struct {
+	conf *config.Config
+
+	mu      sync.Mutex
+	devices map[string]*fixState
+}
+
+// fixState is what the speed check remembers of a tracker. suspect is the
+// last point when it was flagged for its speed: two consistent fixes in a
+// row outvote the reference, e.g. when the reference was the outlier.
+type fixState struct {
+	good    *geo.Point
+	suspect *geo.Point
+}
+
+func newQualityFilter(conf *config.Config) *qualityFilter {
+	return &qualityFilter{
+		conf:    conf,
+		devices: make(map[string]*fixState),
+	}
+}
+
+// check sets the quality flag of the waypoints of a tracker, in time order.
+// The speed check starts over after a restart and skips the points older
+// than the last good fix, such as a cached batch sent late.
+func (f *qualityFilter) check(deviceID string, bounds *event.Bounds, waypoints []*waypoint.WaypointDTO) {
+	sorted := make([]*waypoint.WaypointDTO, len(waypoints))
+	copy(sorted, waypoints)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state, ok := f.devices[deviceID]
+	if !ok {
+		state = new(fixState)
+		f.devices[deviceID] = state
+	}
+
+	for _, w := range sorted {
+		switch {
+		case bounds != nil && !bounds.Contains(w.Latitude, w.Longitude):
+			w.QualityFlag = waypoint.QualityArea
+		case f.conf.Quality.MaxHDOP > 0 && w.HDOP != nil && *w.HDOP > f.conf.Quality.MaxHDOP:
+			w.QualityFlag = waypoint.QualityHDOP
+		default:
+			w.QualityFlag = f.checkSpeed(state, geo.Point{Latitude: w.Latitude, Longitude: w.Longitude, Time: w.CreatedAt})
+		}
+	}
+}
+
+func (f *qualityFilter) checkSpeed(state *fixState, p geo.Point) string {
+	if f.conf.Quality.MaxSpeed <= 0 || state.good == nil {
+		state.good = &p
+		return ""
+	}
+	if p.Time.Before(state.good.Time) {
+		return ""
+	}
+
+	if f.plausible(*state.good, p) || (state.suspect != nil && f.plausible(*state.suspect, p)) {
+		state.good = &p
+		state.suspect = nil
+		return ""
+	}
+
+	state.suspect = &p
+	return waypoint.QualitySpeed
+}
+
+// plausible reports whether the tracker could have moved from a to b at no
+// more than the maximum speed. Fixes less than a second apart count as a
+// second, the timestamps have no finer resolution.
+func (f *qualityFilter) plausible(a, b geo.Point) bool {
+	dt := b.Time.Sub(a.Time)
+	if dt < time.Second {
+		dt = time.Second
+	}
+	speed := geo.Distance(a, b) / dt.Seconds() * 3.6
+	return speed <= f.conf.Quality.MaxSpeed
+}
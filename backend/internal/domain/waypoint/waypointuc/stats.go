@@ -0,0 +1,112 @@
+package waypointuc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/geo"
+)
+
+// movingSpeed is the speed in km/h above which a segment counts as moving
+// time. Processions walk at 2-3 km/h while GPS jitter of a tracker standing
+// still stays well below 1 km/h.
+const movingSpeed = 1.0
+
+// tripStats accumulates the statistics of a track as points are appended
+type tripStats struct {
+	distance    float64
+	cumulative  []float64
+	movingTime  time.Duration
+	stoppedTime time.Duration
+	maxSpeed    int
+	speedSum    int64
+	speedCount  int
+}
+
+// push accounts for the point appended at index i of the track
+func (s *tripStats) push(points []geo.Point, speeds []int, i int) {
+	if speed := speeds[i]; speed > 0 {
+		s.speedSum += int64(speed)
+		s.speedCount++
+		s.maxSpeed = max(s.maxSpeed, speed)
+	}
+
+	if i == 0 {
+		s.cumulative = append(s.cumulative, 0)
+		return
+	}
+
+	d := geo.Distance(points[i-1], points[i])
+	dt := points[i].Time.Sub(points[i-1].Time)
+
+	s.distance += d
+	s.cumulative = append(s.cumulative, s.distance)
+
+	if dt > 0 && d/dt.Hours()/1000 >= movingSpeed {
+		s.movingTime += dt
+	} else {
+		s.stoppedTime += dt
+	}
+}
+
+// rebuild recomputes the statistics from scratch, after a point was
+// inserted in the middle of the track
+func (s *tripStats) rebuild(points []geo.Point, speeds []int) {
+	*s = tripStats{cumulative: make([]float64, 0, len(points))}
+	for i := range points {
+		s.push(points, speeds, i)
+	}
+}
+
+// distanceSince returns the distance covered after the given instant
+func (s *tripStats) distanceSince(points []geo.Point, t time.Time) float64 {
+	i := sort.Search(len(points), func(i int) bool {
+		return !points[i].Time.Before(t)
+	})
+	if i == len(points) {
+		return 0
+	}
+	return s.distance - s.cumulative[i]
+}
+
+// statsDTO returns the statistics of the tracker, the distance since the
+// last stop measured from its departure
+func (d *deviceTrack) statsDTO(deviceID string, lastStop *stop.StopDTO) *event.DeviceStatsDTO {
+	res := &event.DeviceStatsDTO{
+		DeviceID: deviceID,
+		Points:   len(d.points),
+	}
+	if len(d.points) == 0 {
+		return res
+	}
+
+	stats := d.tripStats()
+	first, last := d.points[0].Time, d.points[len(d.points)-1].Time
+
+	res.FirstPointAt = &first
+	res.LastPointAt = &last
+	res.Distance = stats.distance
+	res.MaxSpeed = float64(stats.maxSpeed)
+	if stats.speedCount > 0 {
+		res.AvgSpeed = float64(stats.speedSum) / float64(stats.speedCount)
+	}
+	if stats.movingTime > 0 {
+		res.AvgMovingSpeed = stats.distance / 1000 / stats.movingTime.Hours()
+	}
+	res.Duration = int64(last.Sub(first).Seconds())
+	res.MovingTime = int64(stats.movingTime.Seconds())
+	res.StoppedTime = int64(stats.stoppedTime.Seconds())
+
+	// Before the first stop the whole track counts, while the procession
+	// stands at a stop nothing was covered since
+	res.DistanceSinceLastStop = stats.distance
+	if lastStop != nil {
+		res.DistanceSinceLastStop = 0
+		if lastStop.DepartedAt != nil {
+			res.DistanceSinceLastStop = stats.distanceSince(d.points, *lastStop.DepartedAt)
+		}
+	}
+	return res
+}
@@ -0,0 +1,292 @@
+package waypointuc
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/geo"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/mapmatch"
+	"github.com/google/uuid"
+)
+
+// maxTrackResults bounds how many parameter sets are cached per track
+const maxTrackResults = 16
+
+type thinKey struct {
+	minDistance float64
+	minInterval time.Duration
+}
+
+type resultKey struct {
+	thinKey
+	epsilon   float64
+	maxPoints int
+}
+
+type trackResult struct {
+	version int
+	points  []*waypoint.WaypointDTO
+}
+
+// track holds every waypoint of an event sorted by time, along with the
+// thinning state and the simplified results computed so far. Thinners are
+// fed only the points added since the last request, the Douglas-Peucker
+// pass runs on the thinned points whenever the track has changed.
+type track struct {
+	mu        sync.Mutex
+	loaded    bool
+	version   int
+	waypoints []*waypoint.WaypointDTO
+	points    []geo.Point
+	devices   map[string]*deviceTrack
+	ids       map[uuid.UUID]struct{}
+	thinners  map[thinKey]*geo.Thinner
+	results   map[resultKey]*trackResult
+}
+
+// deviceTrack holds the points of a single tracker sorted by time. The
+// trackers of an event are apart, measuring or matching the interleaved
+// track would add up the hops between them. reordered counts the points
+// inserted before the end, after which the match starts over.
+type deviceTrack struct {
+	points    []geo.Point
+	speeds    []int
+	stats     tripStats
+	dirty     bool
+	reordered int
+	matching  deviceMatch
+}
+
+// deviceMatch is the map matching state of a tracker. It has its own lock,
+// matching runs on a copy of the points without holding the track.
+type deviceMatch struct {
+	mu        sync.Mutex
+	reordered int
+	session   *mapmatch.Session
+}
+
+// matchInput is the track of a tracker copied for matching
+type matchInput struct {
+	deviceID  string
+	reordered int
+	points    []geo.Point
+	matching  *deviceMatch
+}
+
+// trackCache keeps one track per event, uuid.Nil being the track of all
+// the waypoints regardless of their event
+type trackCache struct {
+	mu     sync.Mutex
+	tracks map[uuid.UUID]*track
+}
+
+func newTrackCache() *trackCache {
+	return &trackCache{tracks: make(map[uuid.UUID]*track)}
+}
+
+func (tc *trackCache) get(eventID uuid.UUID) *track {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	t, ok := tc.tracks[eventID]
+	if !ok {
+		t = &track{}
+		tc.tracks[eventID] = t
+	}
+	return t
+}
+
+// add appends freshly stored waypoints to the tracks already loaded
+func (tc *trackCache) add(eventID *uuid.UUID, waypoints []*waypoint.WaypointDTO) {
+	keys := []uuid.UUID{uuid.Nil}
+	if eventID != nil {
+		keys = append(keys, *eventID)
+	}
+	for _, key := range keys {
+		tc.get(key).add(waypoints)
+	}
+}
+
+// reset drops every track, they are reloaded on the next request
+func (tc *trackCache) reset() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.tracks = make(map[uuid.UUID]*track)
+}
+
+// load fills the track from the db unless it was already done. It must be
+// called with the track locked.
+func (t *track) load(fetch func() ([]*waypoint.WaypointDTO, error)) error {
+	if t.loaded {
+		return nil
+	}
+
+	waypoints, err := fetch()
+	if err != nil {
+		return err
+	}
+
+	t.waypoints = nil
+	t.points = nil
+	t.devices = make(map[string]*deviceTrack)
+	t.ids = make(map[uuid.UUID]struct{}, len(waypoints))
+	t.thinners = make(map[thinKey]*geo.Thinner)
+	t.results = make(map[resultKey]*trackResult)
+	t.loaded = true
+	t.insert(waypoints)
+	return nil
+}
+
+func (t *track) add(waypoints []*waypoint.WaypointDTO) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.loaded {
+		t.insert(waypoints)
+	}
+}
+
+// insert keeps the track sorted by time. Points arriving out of order, e.g.
+// a batch the tracker buffered while offline, invalidate the thinners.
+func (t *track) insert(waypoints []*waypoint.WaypointDTO) {
+	for _, w := range waypoints {
+		if _, ok := t.ids[w.ID]; ok {
+			continue
+		}
+		t.ids[w.ID] = struct{}{}
+
+		p := geo.Point{
+			Latitude:  w.Latitude,
+			Longitude: w.Longitude,
+			Time:      w.CreatedAt,
+		}
+
+		i := sort.Search(len(t.points), func(i int) bool {
+			return t.points[i].Time.After(p.Time)
+		})
+		if i == len(t.points) {
+			t.points = append(t.points, p)
+			t.waypoints = append(t.waypoints, w)
+		} else {
+			t.points = append(t.points[:i], append([]geo.Point{p}, t.points[i:]...)...)
+			t.waypoints = append(t.waypoints[:i], append([]*waypoint.WaypointDTO{w}, t.waypoints[i:]...)...)
+			clear(t.thinners)
+		}
+
+		d, ok := t.devices[w.DeviceID]
+		if !ok {
+			d = &deviceTrack{}
+			t.devices[w.DeviceID] = d
+		}
+		d.insert(p, w.Speed)
+		t.version++
+	}
+}
+
+func (d *deviceTrack) insert(p geo.Point, speed int) {
+	i := sort.Search(len(d.points), func(i int) bool {
+		return d.points[i].Time.After(p.Time)
+	})
+	if i == len(d.points) {
+		d.points = append(d.points, p)
+		d.speeds = append(d.speeds, speed)
+		if !d.dirty {
+			d.stats.push(d.points, d.speeds, i)
+		}
+		return
+	}
+
+	d.points = append(d.points[:i], append([]geo.Point{p}, d.points[i:]...)...)
+	d.speeds = append(d.speeds[:i], append([]int{speed}, d.speeds[i:]...)...)
+	d.dirty = true
+	d.reordered++
+}
+
+// tripStats returns the up to date statistics of the tracker. It must be
+// called with the track locked.
+func (d *deviceTrack) tripStats() *tripStats {
+	if d.dirty {
+		d.stats.rebuild(d.points, d.speeds)
+		d.dirty = false
+	}
+	return &d.stats
+}
+
+// simplify returns the simplified track. It must be called with the track
+// locked.
+func (t *track) simplify(opts geo.SimplifyOptions) []*waypoint.WaypointDTO {
+	key := resultKey{
+		thinKey:   thinKey{opts.MinDistance, opts.MinTimeInterval},
+		epsilon:   opts.Epsilon,
+		maxPoints: opts.MaxPoints,
+	}
+	if res, ok := t.results[key]; ok && res.version == t.version {
+		return res.points
+	}
+
+	thinner, ok := t.thinners[key.thinKey]
+	if !ok {
+		if len(t.thinners) >= maxTrackResults {
+			clear(t.thinners)
+		}
+		thinner = geo.NewThinner(opts.MinDistance, opts.MinTimeInterval)
+		t.thinners[key.thinKey] = thinner
+	}
+	for _, p := range t.points[thinner.Len():] {
+		thinner.Add(p)
+	}
+
+	indices := geo.SimplifyThinned(t.points, thinner.Indices(), opts)
+	points := make([]*waypoint.WaypointDTO, len(indices))
+	for i, idx := range indices {
+		points[i] = t.waypoints[idx]
+	}
+
+	if len(t.results) >= maxTrackResults {
+		clear(t.results)
+	}
+	t.results[key] = &trackResult{version: t.version, points: points}
+	return points
+}
+
+// matchInputs copies the points of every tracker, sorted by device ID. It
+// must be called with the track locked.
+func (t *track) matchInputs() []*matchInput {
+	res := make([]*matchInput, 0, len(t.devices))
+	for deviceID, d := range t.devices {
+		res = append(res, &matchInput{
+			deviceID:  deviceID,
+			reordered: d.reordered,
+			points:    slices.Clone(d.points),
+			matching:  &d.matching,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].deviceID < res[j].deviceID
+	})
+	return res
+}
+
+// match returns the track of the tracker snapped onto the road network. The
+// session is extended with the points added since the last match, it
+// starts over when a point was inserted before the end. A copy older than
+// the one already matched is answered with the newer match.
+func (in *matchInput) match(m *mapmatch.Matcher) [][]geo.Point {
+	dm := in.matching
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	if dm.session == nil || in.reordered > dm.reordered {
+		dm.session = m.NewSession()
+		dm.reordered = in.reordered
+	}
+	if in.reordered == dm.reordered {
+		if n := dm.session.Len(); n < len(in.points) {
+			dm.session.Extend(in.points[n:])
+		}
+	}
+	return dm.session.Segments()
+}
@@ -2,76 +2,575 @@ package waypointuc
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/antoniosarro/saint-tracker/backend/config"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
 	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
 	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/antoniosarro/saint-tracker/backend/internal/web/webcontext"
 	"github.com/antoniosarro/saint-tracker/backend/internal/websocket"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/geo"
 	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/mapmatch"
 	"github.com/google/uuid"
 )
 
 type iDBRepository interface {
-	GetList(ctx context.Context) ([]*waypoint.WaypointDTO, error)
+	GetList(ctx context.Context, filter *waypoint.ListFilter) ([]*waypoint.WaypointDTO, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*waypoint.WaypointDTO, error)
 	CreateBatch(ctx context.Context, waypoints []*waypoint.WaypointDTO) error
+	Delete(ctx context.Context, id uuid.UUID) (bool, error)
+}
+
+type iEventRepository interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*event.EventDTO, error)
+	GetActive(ctx context.Context) (*event.EventDTO, error)
+}
+
+// iStopUseCase runs the stop detection over the registered waypoints and
+// provides the planned stops of an event
+type iStopUseCase interface {
+	GetList(ctx context.Context, eventID uuid.UUID) ([]*stop.StopDTO, error)
+	Process(ctx context.Context, eventID uuid.UUID, waypoints []*waypoint.WaypointDTO)
+	LastStop(ctx context.Context, eventID uuid.UUID) (*stop.StopDTO, error)
 }
 
 type UseCase struct {
 	conf        *config.Config
 	log         *logger.Log
 	dbRepo      iDBRepository
+	eventRepo   iEventRepository
+	stops       iStopUseCase
 	broadcaster websocket.Broadcaster
+	tracks      *trackCache
+	quality     *qualityFilter
+	positions   *positionFilter
+	matcher     *mapmatch.Matcher
+
+	// publish serialises the inserts and the updates of the live state with
+	// their broadcasts, so that a snapshot reflects exactly the broadcasts up
+	// to the last event ID read along with it
+	publish sync.Mutex
 }
 
-func New(conf *config.Config, log *logger.Log, dbRepo iDBRepository, broadcaster websocket.Broadcaster) *UseCase {
+// New builds the waypoint use case. matcher is nil when no road network is
+// loaded, map matching is then unavailable.
+func New(conf *config.Config, log *logger.Log, dbRepo iDBRepository, eventRepo iEventRepository, stops iStopUseCase, broadcaster websocket.Broadcaster, matcher *mapmatch.Matcher) *UseCase {
 	return &UseCase{
 		conf:        conf,
 		log:         log,
 		dbRepo:      dbRepo,
+		eventRepo:   eventRepo,
+		stops:       stops,
 		broadcaster: broadcaster,
+		tracks:      newTrackCache(),
+		quality:     newQualityFilter(conf),
+		positions:   newPositionFilter(conf),
+		matcher:     matcher,
 	}
 }
 
-func (uc *UseCase) GetList(ctx context.Context) ([]*waypoint.WaypointDTO, error) {
-	res, err := uc.dbRepo.GetList(ctx)
+// GetList returns the waypoints matching the filter. When no event is given
+// the currently active one is used, falling back to every stored waypoint
+// when nothing is running. The returned cursor is set when the page is full
+// and more waypoints may follow.
+func (uc *UseCase) GetList(ctx context.Context, filter *waypoint.ListFilter) ([]*waypoint.WaypointDTO, *uuid.UUID, error) {
+	if filter.EventID == nil {
+		active, err := uc.activeEventID(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		filter.EventID = active
+	}
+
+	if filter.SinceID != nil {
+		if _, err := uc.dbRepo.GetByID(ctx, *filter.SinceID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, nil, httperrors.New(httperrors.InvalidArgument, "Unknown since cursor")
+			}
+			uc.log.Errorf("waypoint cursor lookup error, %v", err)
+			return nil, nil, httperrors.New(httperrors.Internal, "Could not retrieve waypoints data from db")
+		}
+	}
+
+	res, err := uc.dbRepo.GetList(ctx, filter)
 	if err != nil {
 		fmt.Println(err)
-		return nil, httperrors.New(httperrors.Internal, "Could not retrieve waypoints data from db")
+		return nil, nil, httperrors.New(httperrors.Internal, "Could not retrieve waypoints data from db")
+	}
+
+	var next *uuid.UUID
+	if filter.Limit > 0 && len(res) == filter.Limit {
+		next = &res[len(res)-1].ID
+	}
+	return res, next, nil
+}
+
+// GetTrack returns the simplified polyline of an event, defaulting to the
+// active one like GetList. The track is kept in memory and updated as
+// waypoints are registered, so repeated requests only process new points.
+func (uc *UseCase) GetTrack(ctx context.Context, opts *waypoint.TrackOptions) (*waypoint.TrackDTO, error) {
+	if opts.EventID == nil {
+		active, err := uc.activeEventID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		opts.EventID = active
+	}
+
+	t, err := uc.lockTrack(ctx, opts.EventID)
+	if err != nil {
+		return nil, err
+	}
+	defer t.mu.Unlock()
+
+	points := t.simplify(geo.SimplifyOptions{
+		MinDistance:     opts.MinDistance,
+		MinTimeInterval: time.Duration(opts.MinTimeInterval) * time.Second,
+		Epsilon:         opts.Epsilon,
+		MaxPoints:       opts.MaxPoints,
+	})
+
+	return &waypoint.TrackDTO{
+		EventID:     opts.EventID,
+		TotalPoints: len(t.points),
+		Points:      points,
+	}, nil
+}
+
+// GetMatchedTrack returns the track of an event snapped onto the road
+// network, defaulting to the active event like GetTrack. Each tracker is
+// matched on its own track, the match is extended as new waypoints are
+// registered.
+func (uc *UseCase) GetMatchedTrack(ctx context.Context, eventID *uuid.UUID) (*waypoint.MatchedTrackDTO, error) {
+	if uc.matcher == nil {
+		return nil, httperrors.New(httperrors.Unavailable, "Map matching is not available, no road network is loaded")
+	}
+
+	if eventID == nil {
+		active, err := uc.activeEventID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		eventID = active
+	}
+
+	t, err := uc.lockTrack(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	inputs := t.matchInputs()
+	res := &waypoint.MatchedTrackDTO{
+		EventID:     eventID,
+		TotalPoints: len(t.points),
+		Segments:    [][][2]float64{},
+	}
+	// Matching takes a while on long tracks, registering waypoints must not
+	// wait for it
+	t.mu.Unlock()
+
+	for _, in := range inputs {
+		for _, line := range in.match(uc.matcher) {
+			segment := make([][2]float64, len(line))
+			for j, p := range line {
+				segment[j] = [2]float64{p.Latitude, p.Longitude}
+			}
+			res.Segments = append(res.Segments, segment)
+		}
+	}
+	return res, nil
+}
+
+// Snapshot returns the live state of an event, defaulting to the active
+// one: the smoothed positions of its trackers, the track simplified with
+// the default parameters and its stops. It is taken while no change can be
+// broadcast, along with the ID of the last broadcast it reflects.
+func (uc *UseCase) Snapshot(ctx context.Context, eventID *uuid.UUID) (*waypoint.SnapshotDTO, error) {
+	if eventID == nil {
+		active, err := uc.activeEventID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		eventID = active
+	}
+
+	uc.publish.Lock()
+	defer uc.publish.Unlock()
+
+	res := &waypoint.SnapshotDTO{
+		EventID:   eventID,
+		Positions: uc.positions.list(eventID),
+		Stops:     []*stop.StopDTO{},
+	}
+	if uc.broadcaster != nil {
+		res.LastEventID = uc.broadcaster.LastEventID()
+	}
+
+	track, err := uc.GetTrack(ctx, &waypoint.TrackOptions{
+		EventID:         eventID,
+		Epsilon:         waypoint.DefaultTrackEpsilon,
+		MinDistance:     waypoint.DefaultTrackMinDistance,
+		MinTimeInterval: waypoint.DefaultTrackMinTimeInterval,
+		MaxPoints:       waypoint.DefaultTrackMaxPoints,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Track = track
+
+	if eventID != nil {
+		stops, err := uc.stops.GetList(ctx, *eventID)
+		if err != nil {
+			return nil, err
+		}
+		res.Stops = append(res.Stops, stops...)
 	}
 	return res, nil
 }
 
+// Register stores the points sent by a tracker. Points it had already sent
+// come back marked as duplicates and are not processed or broadcast again.
+// Bad fixes are flagged, or rejected and not stored when so configured,
+// they are left out of the tracks and of the stop detection.
 func (uc *UseCase) Register(ctx context.Context, wcs []*waypoint.NewWaypointDTO) ([]*waypoint.WaypointDTO, error) {
 	var waypoints []*waypoint.WaypointDTO
 
+	active, err := uc.activeEvent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var eventID *uuid.UUID
+	var bounds *event.Bounds
+	if active != nil {
+		eventID = &active.ID
+		bounds = active.Bounds
+	} else {
+		uc.log.Warn("No active event, waypoints will be stored without an event")
+	}
+
+	// Points are deduplicated per device, those without a device such as
+	// imports are always inserted
+	deviceID, _ := webcontext.GetDeviceID(ctx)
+
 	for _, wc := range wcs {
 		w := &waypoint.WaypointDTO{
-			ID:        uuid.New(),
-			Latitude:  wc.Latitude,
-			Longitude: wc.Longitude,
-			Speed:     wc.Speed,
-			CreatedAt: time.Unix(wc.CreatedAt, 0),
+			ID:         uuid.New(),
+			EventID:    eventID,
+			Latitude:   wc.Latitude,
+			Longitude:  wc.Longitude,
+			Speed:      wc.Speed,
+			Altitude:   wc.Altitude,
+			Heading:    wc.Heading,
+			HDOP:       wc.HDOP,
+			Satellites: wc.Satellites,
+			Accuracy:   wc.Accuracy,
+			DeviceID:   deviceID,
+			ClientID:   wc.ClientID,
+			CreatedAt:  time.Unix(wc.CreatedAt, 0).UTC(),
 		}
 		waypoints = append(waypoints, w)
 	}
 
-	if err := uc.dbRepo.CreateBatch(ctx, waypoints); err != nil {
+	uc.quality.check(deviceID, bounds, waypoints)
+
+	stored := waypoints
+	if uc.conf.Quality.Reject {
+		stored = make([]*waypoint.WaypointDTO, 0, len(waypoints))
+		for _, w := range waypoints {
+			if w.QualityFlag != "" {
+				w.Rejected = true
+				uc.log.Warnf("waypoint from %s at %s rejected, bad %s", deviceID, w.CreatedAt.Format(time.RFC3339), w.QualityFlag)
+				continue
+			}
+			stored = append(stored, w)
+		}
+	}
+
+	// Points are inserted under the publish lock, otherwise a snapshot
+	// loading the track from the db in between would have them and get
+	// them again from the broadcast
+	uc.publish.Lock()
+	defer uc.publish.Unlock()
+
+	if err := uc.dbRepo.CreateBatch(ctx, stored); err != nil {
 		fmt.Println(err)
 		return nil, httperrors.New(httperrors.Internal, "Error inserting waypoints")
 	}
 
-	// Broadcast the new waypoints to WebSocket clients
+	// Duplicates were already processed when first received
+	added := make([]*waypoint.WaypointDTO, 0, len(stored))
+	good := make([]*waypoint.WaypointDTO, 0, len(stored))
+	for _, w := range stored {
+		if w.Duplicate {
+			continue
+		}
+		added = append(added, w)
+		if w.QualityFlag == "" {
+			good = append(good, w)
+		}
+	}
+	if len(added) < len(stored) {
+		uc.log.Infof("%d of %d waypoints from %s were duplicates", len(stored)-len(added), len(stored), deviceID)
+	}
+	if len(added) == 0 {
+		return waypoints, nil
+	}
+
+	var position *waypoint.PositionDTO
+	if len(good) > 0 {
+		uc.tracks.add(eventID, good)
+		if eventID != nil {
+			uc.stops.Process(ctx, *eventID, good)
+		}
+		if uc.conf.Position.Enabled && deviceID != "" {
+			position = uc.positions.update(deviceID, good)
+		}
+	}
+
+	// Broadcast the new waypoints to WebSocket clients, flagged ones
+	// included since clients choose whether to show them, followed by the
+	// smoothed position of the tracker. Messages are queued even with no
+	// client connected, the hub keeps them for the ones resuming.
 	if uc.broadcaster != nil {
-		go func() {
-			clientCount := uc.broadcaster.GetClientCount()
-			if clientCount > 0 {
-				uc.log.Infof("Broadcasting %d new waypoints to %d WebSocket clients", len(waypoints), clientCount)
-				uc.broadcaster.BroadcastWaypoints(waypoints)
-			}
-		}()
+		uc.log.Infof("Broadcasting %d new waypoints to %d WebSocket clients", len(added), uc.broadcaster.GetClientCount())
+		uc.broadcaster.BroadcastWaypoints(added)
+		if position != nil {
+			uc.broadcaster.BroadcastPosition(position)
+		}
 	}
 
 	return waypoints, nil
 }
+
+// RestorePositions rebuilds the smoothed positions of the trackers from
+// their latest good fixes of the active event, so the live position does
+// not start over from the first fix received after a restart
+func (uc *UseCase) RestorePositions(ctx context.Context) error {
+	if !uc.conf.Position.Enabled {
+		return nil
+	}
+
+	eventID, err := uc.activeEventID(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := uc.dbRepo.GetList(ctx, &waypoint.ListFilter{
+		EventID:        eventID,
+		Limit:          positionReplayPoints,
+		Desc:           true,
+		ExcludeFlagged: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	byDevice := make(map[string][]*waypoint.WaypointDTO)
+	for _, w := range res {
+		if w.DeviceID != "" {
+			byDevice[w.DeviceID] = append(byDevice[w.DeviceID], w)
+		}
+	}
+	for deviceID, waypoints := range byDevice {
+		uc.positions.update(deviceID, waypoints)
+	}
+
+	uc.log.Infof("restored the positions of %d trackers from %d waypoints", len(byDevice), len(res))
+	return nil
+}
+
+// Delete removes a bad waypoint, e.g. a GPS glitch far off the route
+func (uc *UseCase) Delete(ctx context.Context, id uuid.UUID) error {
+	deleted, err := uc.dbRepo.Delete(ctx, id)
+	if err != nil {
+		uc.log.Errorf("waypoint delete error, %v", err)
+		return httperrors.New(httperrors.Internal, "Error deleting waypoint")
+	}
+	if !deleted {
+		return httperrors.New(httperrors.NotFound, "Waypoint not found")
+	}
+
+	// Deletions are rare, rebuilding the cached tracks is simpler than
+	// finding the ones holding the waypoint
+	uc.tracks.reset()
+	return nil
+}
+
+// Export streams the waypoints matching the filter into w, along with the
+// planned stops when the export covers an event. The event defaults to the
+// active one like GetList. Waypoints are read page by page so the db is not
+// held for the whole download.
+func (uc *UseCase) Export(ctx context.Context, filter *waypoint.ListFilter, w waypoint.ExportWriter) error {
+	if filter.EventID == nil {
+		active, err := uc.activeEventID(ctx)
+		if err != nil {
+			return err
+		}
+		filter.EventID = active
+	}
+
+	info := &waypoint.ExportInfo{
+		EventID: filter.EventID,
+		Name:    "Saint Tracker",
+		From:    filter.From,
+		To:      filter.To,
+	}
+
+	var stops []*stop.StopDTO
+	if filter.EventID != nil {
+		e, err := uc.eventRepo.GetByID(ctx, *filter.EventID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return httperrors.New(httperrors.NotFound, "Event not found")
+			}
+			uc.log.Errorf("event get error, %v", err)
+			return httperrors.New(httperrors.Internal, "Could not retrieve event data from db")
+		}
+		info.Name = e.Name
+		info.Description = e.Saint
+		if e.Town != "" {
+			info.Description += ", " + e.Town
+		}
+
+		if stops, err = uc.stops.GetList(ctx, e.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Begin(info); err != nil {
+		return err
+	}
+	for _, s := range stops {
+		if err := w.WriteStop(s); err != nil {
+			return err
+		}
+	}
+
+	page := *filter
+	page.Limit = waypoint.ExportPageSize
+	page.Desc = false
+	for {
+		res, err := uc.dbRepo.GetList(ctx, &page)
+		if err != nil {
+			uc.log.Errorf("waypoint export error, %v", err)
+			return httperrors.New(httperrors.Internal, "Could not retrieve waypoints data from db")
+		}
+		for _, p := range res {
+			if err := w.WritePoint(p); err != nil {
+				return err
+			}
+		}
+		if len(res) < page.Limit {
+			break
+		}
+		page.SinceID = &res[len(res)-1].ID
+		page.SinceTime = nil
+	}
+
+	return w.End()
+}
+
+// GetStats returns the trip statistics of an event, computed over the whole
+// stored track of each of its trackers and kept up to date as waypoints are
+// registered
+func (uc *UseCase) GetStats(ctx context.Context, eventID uuid.UUID) (*event.StatsDTO, error) {
+	if _, err := uc.eventRepo.GetByID(ctx, eventID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperrors.New(httperrors.NotFound, "Event not found")
+		}
+		uc.log.Errorf("event get error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve event data from db")
+	}
+
+	lastStop, err := uc.stops.LastStop(ctx, eventID)
+	if err != nil {
+		uc.log.Errorf("last stop lookup error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve stops data from db")
+	}
+
+	t, err := uc.lockTrack(ctx, &eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer t.mu.Unlock()
+
+	res := &event.StatsDTO{
+		EventID: eventID,
+		Devices: make([]*event.DeviceStatsDTO, 0, len(t.devices)),
+	}
+	if lastStop != nil {
+		res.LastStop = lastStop.Letter
+		res.LastStopDepartedAt = lastStop.DepartedAt
+	}
+
+	for deviceID, d := range t.devices {
+		res.Devices = append(res.Devices, d.statsDTO(deviceID, lastStop))
+	}
+	// The primary tracker first, ties broken by ID for a stable order
+	sort.Slice(res.Devices, func(i, j int) bool {
+		a, b := res.Devices[i], res.Devices[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		return a.DeviceID < b.DeviceID
+	})
+	if len(res.Devices) > 0 {
+		res.DeviceStatsDTO = *res.Devices[0]
+	}
+
+	return res, nil
+}
+
+// lockTrack returns the in-memory track of an event, or of every waypoint
+// when eventID is nil, loading it from the db on first use. The track is
+// returned locked.
+func (uc *UseCase) lockTrack(ctx context.Context, eventID *uuid.UUID) (*track, error) {
+	key := uuid.Nil
+	if eventID != nil {
+		key = *eventID
+	}
+
+	t := uc.tracks.get(key)
+	t.mu.Lock()
+
+	err := t.load(func() ([]*waypoint.WaypointDTO, error) {
+		return uc.dbRepo.GetList(ctx, &waypoint.ListFilter{EventID: eventID, ExcludeFlagged: true})
+	})
+	if err != nil {
+		t.mu.Unlock()
+		uc.log.Errorf("waypoint track load error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve waypoints data from db")
+	}
+	return t, nil
+}
+
+// activeEventID returns the ID of the event currently in progress, or nil
+// when no event is active.
+func (uc *UseCase) activeEventID(ctx context.Context) (*uuid.UUID, error) {
+	active, err := uc.activeEvent(ctx)
+	if err != nil || active == nil {
+		return nil, err
+	}
+	return &active.ID, nil
+}
+
+// activeEvent returns the event currently in progress, or nil when no event
+// is active.
+func (uc *UseCase) activeEvent(ctx context.Context) (*event.EventDTO, error) {
+	active, err := uc.eventRepo.GetActive(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		uc.log.Errorf("active event lookup error, %v", err)
+		return nil, httperrors.New(httperrors.Internal, "Could not retrieve active event from db")
+	}
+	return active, nil
+}
@@ -5,17 +5,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
 	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
 	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/validate"
+	"github.com/antoniosarro/saint-tracker/backend/internal/web/webcontext"
 	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
 type iUseCase interface {
-	GetList(ctx context.Context) ([]*waypoint.WaypointDTO, error)
+	GetList(ctx context.Context, filter *waypoint.ListFilter) ([]*waypoint.WaypointDTO, *uuid.UUID, error)
+	GetTrack(ctx context.Context, opts *waypoint.TrackOptions) (*waypoint.TrackDTO, error)
+	GetMatchedTrack(ctx context.Context, eventID *uuid.UUID) (*waypoint.MatchedTrackDTO, error)
+	Export(ctx context.Context, filter *waypoint.ListFilter, w waypoint.ExportWriter) error
 	Register(ctx context.Context, wcs []*waypoint.NewWaypointDTO) ([]*waypoint.WaypointDTO, error)
+	Delete(ctx context.Context, id uuid.UUID) error
 }
 
 type controller struct {
@@ -28,34 +35,115 @@ func newController(waypointUC iUseCase, log *logger.Log) *controller {
 }
 
 func (con *controller) list(c echo.Context) error {
-	w, err := con.waypointUC.GetList(c.Request().Context())
+	filter, err := parseListFilter(c)
 	if err != nil {
 		return err
 	}
+
+	w, next, err := con.waypointUC.GetList(c.Request().Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	// The body stays a plain array, the cursor of the next page travels in
+	// the headers
+	if next != nil {
+		q := c.Request().URL.Query()
+		q.Set("since", next.String())
+		nextURL := *c.Request().URL
+		nextURL.RawQuery = q.Encode()
+
+		c.Response().Header().Set(HeaderNextCursor, next.String())
+		c.Response().Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, nextURL.RequestURI()))
+	}
 	return c.JSON(http.StatusOK, w)
 }
 
+func (con *controller) track(c echo.Context) error {
+	opts, err := parseTrackOptions(c)
+	if err != nil {
+		return err
+	}
+
+	if err := opts.Validate(); err != nil {
+		e := httperrors.New(httperrors.InvalidArgument, "Invalid track parameters")
+		for _, s := range validate.SplitErrors(err) {
+			e.AddDetail(s)
+		}
+		return e
+	}
+
+	t, err := con.waypointUC.GetTrack(c.Request().Context(), opts)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+// matched returns the track snapped onto the road network, the event
+// defaults to the active one
+func (con *controller) matched(c echo.Context) error {
+	var eventID *uuid.UUID
+	if param := c.QueryParam("event_id"); param != "" {
+		id, err := uuid.Parse(param)
+		if err != nil {
+			return httperrors.New(httperrors.InvalidArgument, "Invalid event_id")
+		}
+		eventID = &id
+	}
+
+	t, err := con.waypointUC.GetMatchedTrack(c.Request().Context(), eventID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+func (con *controller) exportGPX(c echo.Context) error {
+	return con.export(c, formatGPX)
+}
+
+func (con *controller) exportGeoJSON(c echo.Context) error {
+	return con.export(c, formatGeoJSON)
+}
+
+func (con *controller) exportCSV(c echo.Context) error {
+	return con.export(c, formatCSV)
+}
+
+func (con *controller) exportKML(c echo.Context) error {
+	return con.export(c, formatKML)
+}
+
+// export streams the track as a file download. It takes the listing
+// filters, limit and order aside since the whole track is exported.
+func (con *controller) export(c echo.Context, format *exportFormat) error {
+	filter, err := parseListFilter(c)
+	if err != nil {
+		return err
+	}
+
+	w := &fileExport{c: c, format: format}
+	if err := con.waypointUC.Export(c.Request().Context(), filter, w); err != nil {
+		// Once the download started the status can no longer change
+		if c.Response().Committed {
+			con.log.Errorf("waypoint export interrupted, %v", err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
 func (con *controller) register(c echo.Context) error {
 	var body json.RawMessage
 	if err := c.Bind(&body); err != nil {
 		return httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
 	}
 
-	// Try to parse as array first
-	var dtoArray []*waypoint.NewWaypointDTO
-	var dtos []*waypoint.NewWaypointDTO
-
-	// Check if it's an array by trying to unmarshal as array
-	if err := json.Unmarshal(body, &dtoArray); err == nil && len(dtoArray) > 0 {
-		// It's an array
-		dtos = dtoArray
-	} else {
-		// Try as single object
-		dto := new(waypoint.NewWaypointDTO)
-		if err := json.Unmarshal(body, dto); err != nil {
-			return httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
-		}
-		dtos = []*waypoint.NewWaypointDTO{dto}
+	dtos, isArray, err := waypoint.DecodeNewWaypoints(body)
+	if err != nil {
+		return httperrors.New(httperrors.InvalidArgument, "Invalid JSON body")
 	}
 
 	// Validate all DTOs
@@ -77,12 +165,58 @@ func (con *controller) register(c echo.Context) error {
 		return err
 	}
 
+	// Created unless every point was a duplicate or rejected
+	status := http.StatusOK
+	for _, w := range waypoints {
+		if !w.Duplicate && !w.Rejected {
+			status = http.StatusCreated
+			break
+		}
+	}
+
 	// Return appropriate response based on input type
-	if len(waypoints) == 1 && len(dtoArray) == 0 {
+	if len(waypoints) == 1 && !isArray {
 		// Single item was sent, return single item
-		return c.JSON(http.StatusCreated, waypoints[0])
+		return c.JSON(status, waypoints[0])
 	} else {
 		// Array was sent, return array
-		return c.JSON(http.StatusCreated, waypoints)
+		return c.JSON(status, waypoints)
+	}
+}
+
+// osmand registers a position sent by a phone app with the OsmAnd protocol.
+// The apps only look at the status code, anything but 200 makes them retry.
+// A position that can never be accepted is logged and acknowledged so the
+// app drops it instead of resending it forever.
+func (con *controller) osmand(c echo.Context) error {
+	deviceID, _ := webcontext.GetDeviceID(c.Request().Context())
+
+	dto, err := parseOsmAnd(c)
+	if err != nil {
+		con.log.Warnf("OsmAnd position of %s rejected, %v", deviceID, err)
+		return c.NoContent(http.StatusOK)
+	}
+
+	if err := dto.Validate(); err != nil {
+		con.log.Warnf("OsmAnd position of %s rejected, %s", deviceID, strings.Join(validate.SplitErrors(err), "; "))
+		return c.NoContent(http.StatusOK)
+	}
+
+	waypoints, err := con.waypointUC.Register(c.Request().Context(), []*waypoint.NewWaypointDTO{dto})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, waypoints[0])
+}
+
+func (con *controller) delete(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return httperrors.New(httperrors.InvalidArgument, "Invalid waypoint id")
+	}
+
+	if err := con.waypointUC.Delete(c.Request().Context(), id); err != nil {
+		return err
 	}
+	return c.NoContent(http.StatusNoContent)
 }
@@ -0,0 +1,146 @@
+package waypointweb
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/trackio"
+	"github.com/labstack/echo/v4"
+)
+
+// trackWriter is implemented by the trackio writers
+type trackWriter interface {
+	WriteWaypoint(wpt trackio.Waypoint) error
+	WritePoint(p trackio.Point) error
+	Close() error
+}
+
+// exportFormat is a downloadable track format
+type exportFormat struct {
+	contentType string
+	extension   string
+	open        func(w io.Writer, meta trackio.Metadata) (trackWriter, error)
+}
+
+var (
+	formatGPX = &exportFormat{
+		contentType: "application/gpx+xml",
+		extension:   "gpx",
+		open: func(w io.Writer, meta trackio.Metadata) (trackWriter, error) {
+			return trackio.NewGPXWriter(w, meta)
+		},
+	}
+	formatGeoJSON = &exportFormat{
+		contentType: "application/geo+json",
+		extension:   "geojson",
+		open: func(w io.Writer, meta trackio.Metadata) (trackWriter, error) {
+			return trackio.NewGeoJSONWriter(w, meta)
+		},
+	}
+	formatCSV = &exportFormat{
+		contentType: "text/csv",
+		extension:   "csv",
+		open: func(w io.Writer, meta trackio.Metadata) (trackWriter, error) {
+			return trackio.NewCSVWriter(w, meta)
+		},
+	}
+	formatKML = &exportFormat{
+		contentType: "application/vnd.google-earth.kml+xml",
+		extension:   "kml",
+		open: func(w io.Writer, meta trackio.Metadata) (trackWriter, error) {
+			return trackio.NewKMLWriter(w, meta)
+		},
+	}
+)
+
+// fileExport writes an export as a download in the given format
+type fileExport struct {
+	c      echo.Context
+	format *exportFormat
+	w      trackWriter
+}
+
+func (e *fileExport) Begin(info *waypoint.ExportInfo) error {
+	res := e.c.Response()
+	res.Header().Set(echo.HeaderContentType, e.format.contentType)
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, exportFilename(info), e.format.extension))
+	res.WriteHeader(http.StatusOK)
+
+	var err error
+	e.w, err = e.format.open(res, trackio.Metadata{
+		Name:        info.Name,
+		Description: info.Description,
+		Time:        time.Now(),
+	})
+	return err
+}
+
+func (e *fileExport) WriteStop(s *stop.StopDTO) error {
+	wpt := trackio.Waypoint{
+		Name:        s.Letter + " - " + s.Name,
+		Description: stopDescription(s),
+		Latitude:    s.Latitude,
+		Longitude:   s.Longitude,
+	}
+	if s.ArrivedAt != nil {
+		wpt.Time = *s.ArrivedAt
+	}
+	return e.w.WriteWaypoint(wpt)
+}
+
+func (e *fileExport) WritePoint(w *waypoint.WaypointDTO) error {
+	return e.w.WritePoint(trackio.Point{
+		Latitude:   w.Latitude,
+		Longitude:  w.Longitude,
+		Time:       w.CreatedAt,
+		Speed:      float64(w.Speed),
+		Altitude:   w.Altitude,
+		Heading:    w.Heading,
+		HDOP:       w.HDOP,
+		Satellites: w.Satellites,
+		Accuracy:   w.Accuracy,
+	})
+}
+
+func (e *fileExport) End() error {
+	return e.w.Close()
+}
+
+// stopDescription summarizes the visit of a stop
+func stopDescription(s *stop.StopDTO) string {
+	switch s.Status {
+	case stop.StatusDone:
+		return fmt.Sprintf("Stop %d, visited for %s", s.VisitOrder, time.Duration(s.Duration)*time.Second)
+	case stop.StatusArrived:
+		return fmt.Sprintf("Stop %d, in progress", s.VisitOrder)
+	case stop.StatusSkipped:
+		return fmt.Sprintf("Stop %d, skipped", s.VisitOrder)
+	default:
+		return fmt.Sprintf("Stop %d, not reached", s.VisitOrder)
+	}
+}
+
+// exportFilename names the download after the event, or after the export
+// date when the export is not bound to an event
+func exportFilename(info *waypoint.ExportInfo) string {
+	if info.EventID == nil {
+		return "saint-tracker-" + time.Now().UTC().Format("2006-01-02")
+	}
+
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '-'
+		}
+	}, info.Name)
+	return strings.Trim(name, "-") + "-" + info.EventID.String()[:8]
+}
@@ -0,0 +1,103 @@
+package waypointweb
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/labstack/echo/v4"
+)
+
+// knotsToKmh converts the OsmAnd speeds, in knots, to km/h
+const knotsToKmh = 1.852
+
+// parseOsmAnd reads a position sent with the OsmAnd protocol used by
+// Traccar Client and OsmAnd, as query string or form parameters: lat, lon,
+// timestamp (unix seconds or milliseconds, or a date), speed in knots,
+// bearing, altitude, accuracy and hdop. The device id is read by the
+// authentication.
+func parseOsmAnd(c echo.Context) (*waypoint.NewWaypointDTO, error) {
+	dto := new(waypoint.NewWaypointDTO)
+
+	lat, err := parseFloatParam(c, "lat")
+	if err != nil {
+		return nil, err
+	}
+	lon, err := parseFloatParam(c, "lon")
+	if err != nil {
+		return nil, err
+	}
+	if lat == nil || lon == nil {
+		return nil, httperrors.New(httperrors.InvalidArgument, "Missing lat or lon")
+	}
+	dto.Latitude = *lat
+	dto.Longitude = *lon
+
+	speed, err := parseFloatParam(c, "speed")
+	if err != nil {
+		return nil, err
+	}
+	if speed != nil {
+		dto.Speed = int(math.Round(*speed * knotsToKmh))
+	}
+
+	if dto.Heading, err = parseFloatParam(c, "bearing"); err != nil {
+		return nil, err
+	}
+	if dto.Altitude, err = parseFloatParam(c, "altitude"); err != nil {
+		return nil, err
+	}
+	if dto.Accuracy, err = parseFloatParam(c, "accuracy"); err != nil {
+		return nil, err
+	}
+	if dto.HDOP, err = parseFloatParam(c, "hdop"); err != nil {
+		return nil, err
+	}
+
+	createdAt := time.Now().UTC()
+	if param := c.FormValue("timestamp"); param != "" {
+		if createdAt, err = parseOsmAndTime(param); err != nil {
+			return nil, err
+		}
+	}
+	dto.CreatedAt = createdAt.Unix()
+
+	return dto, nil
+}
+
+// parseFloatParam returns nil when the parameter is missing
+func parseFloatParam(c echo.Context, name string) (*float64, error) {
+	param := c.FormValue(name)
+	if param == "" {
+		return nil, nil
+	}
+
+	v, err := strconv.ParseFloat(param, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, httperrors.New(httperrors.InvalidArgument, fmt.Sprintf("Invalid %s", name))
+	}
+	return &v, nil
+}
+
+// parseOsmAndTime accepts the formats sent by the various clients, unix
+// seconds, unix milliseconds and dates
+func parseOsmAndTime(param string) (time.Time, error) {
+	if n, err := strconv.ParseInt(param, 10, 64); err == nil {
+		// Milliseconds since 1970 pass 1e12 in 2001, seconds will not
+		// before the year 33658
+		if n > 1e12 {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, param); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, httperrors.New(httperrors.InvalidArgument, "Invalid timestamp, expected a unix timestamp or a date")
+}
@@ -0,0 +1,137 @@
+package waypointweb
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderNextCursor carries the cursor of the next page of a listing
+const HeaderNextCursor = "X-Next-Cursor"
+
+// parseListFilter reads the listing query parameters: event_id, from, to,
+// since (a waypoint id or a timestamp), limit, order (asc or desc) and
+// exclude_flagged
+func parseListFilter(c echo.Context) (*waypoint.ListFilter, error) {
+	filter := new(waypoint.ListFilter)
+
+	if param := c.QueryParam("event_id"); param != "" {
+		id, err := uuid.Parse(param)
+		if err != nil {
+			return nil, httperrors.New(httperrors.InvalidArgument, "Invalid event_id")
+		}
+		filter.EventID = &id
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(c, "from"); err != nil {
+		return nil, err
+	}
+	if filter.To, err = parseTimeParam(c, "to"); err != nil {
+		return nil, err
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return nil, httperrors.New(httperrors.InvalidArgument, "to must not be before from")
+	}
+
+	if param := c.QueryParam("since"); param != "" {
+		if id, err := uuid.Parse(param); err == nil {
+			filter.SinceID = &id
+		} else if filter.SinceTime, err = parseTimeParam(c, "since"); err != nil {
+			return nil, httperrors.New(httperrors.InvalidArgument, "since must be a waypoint id or a timestamp")
+		}
+	}
+
+	if param := c.QueryParam("limit"); param != "" {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > waypoint.MaxListLimit {
+			return nil, httperrors.New(httperrors.InvalidArgument, fmt.Sprintf("limit must be between 1 and %d", waypoint.MaxListLimit))
+		}
+		filter.Limit = limit
+	}
+
+	switch c.QueryParam("order") {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return nil, httperrors.New(httperrors.InvalidArgument, "order must be asc or desc")
+	}
+
+	if param := c.QueryParam("exclude_flagged"); param != "" {
+		exclude, err := strconv.ParseBool(param)
+		if err != nil {
+			return nil, httperrors.New(httperrors.InvalidArgument, "exclude_flagged must be true or false")
+		}
+		filter.ExcludeFlagged = exclude
+	}
+
+	return filter, nil
+}
+
+// parseTrackOptions reads the track query parameters: event_id, epsilon,
+// minDistance, minTimeInterval and maxPoints. Missing ones take the
+// defaults of the frontend filter.
+func parseTrackOptions(c echo.Context) (*waypoint.TrackOptions, error) {
+	opts := &waypoint.TrackOptions{
+		Epsilon:         waypoint.DefaultTrackEpsilon,
+		MinDistance:     waypoint.DefaultTrackMinDistance,
+		MinTimeInterval: waypoint.DefaultTrackMinTimeInterval,
+		MaxPoints:       waypoint.DefaultTrackMaxPoints,
+	}
+
+	if param := c.QueryParam("event_id"); param != "" {
+		id, err := uuid.Parse(param)
+		if err != nil {
+			return nil, httperrors.New(httperrors.InvalidArgument, "Invalid event_id")
+		}
+		opts.EventID = &id
+	}
+
+	for name, dst := range map[string]*float64{"epsilon": &opts.Epsilon, "minDistance": &opts.MinDistance} {
+		if param := c.QueryParam(name); param != "" {
+			v, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return nil, httperrors.New(httperrors.InvalidArgument, fmt.Sprintf("Invalid %s, expected a number", name))
+			}
+			*dst = v
+		}
+	}
+
+	for name, dst := range map[string]*int{"minTimeInterval": &opts.MinTimeInterval, "maxPoints": &opts.MaxPoints} {
+		if param := c.QueryParam(name); param != "" {
+			v, err := strconv.Atoi(param)
+			if err != nil {
+				return nil, httperrors.New(httperrors.InvalidArgument, fmt.Sprintf("Invalid %s, expected an integer", name))
+			}
+			*dst = v
+		}
+	}
+
+	return opts, nil
+}
+
+// parseTimeParam accepts either a unix timestamp in seconds or an RFC 3339
+// date
+func parseTimeParam(c echo.Context, name string) (*time.Time, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return nil, nil
+	}
+
+	if sec, err := strconv.ParseInt(param, 10, 64); err == nil {
+		t := time.Unix(sec, 0).UTC()
+		return &t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		return nil, httperrors.New(httperrors.InvalidArgument, fmt.Sprintf("Invalid %s, expected a unix timestamp or an RFC 3339 date", name))
+	}
+	return &t, nil
+}
@@ -1,6 +1,7 @@
 package waypointweb
 
 import (
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator"
 	"github.com/antoniosarro/saint-tracker/backend/internal/web"
 	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
 )
@@ -15,5 +16,14 @@ func Route(web *web.Web, opts *Options) {
 
 	g := web.Echo.Group("/api/v1/waypoint")
 	g.GET("/list", con.list)
+	g.GET("/track", con.track)
+	g.GET("/matched", con.matched)
+	g.GET("/export.gpx", con.exportGPX)
+	g.GET("/export.geojson", con.exportGeoJSON)
+	g.GET("/export.kml", con.exportKML)
+	g.GET("/export.csv", con.exportCSV)
 	g.POST("/register", con.register, web.Mid.Authenticated)
+	g.GET("/osmand", con.osmand, web.Mid.AuthenticatedByQuery)
+	g.POST("/osmand", con.osmand, web.Mid.AuthenticatedByQuery)
+	g.DELETE("/:id", con.delete, web.Mid.RequireRole(operator.RoleOperator))
 }
@@ -0,0 +1,119 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// Topic layout, trackers publish their positions on
+// saint-tracker/{serial}/position
+const (
+	TopicPrefix   = "saint-tracker/"
+	TopicPosition = "position"
+)
+
+// Authenticator checks the credentials of a tracker
+type Authenticator interface {
+	AuthenticateDevice(ctx context.Context, deviceID, token string) error
+}
+
+// Registerer stores the waypoints received from a tracker
+type Registerer interface {
+	Register(ctx context.Context, wcs []*waypoint.NewWaypointDTO) ([]*waypoint.WaypointDTO, error)
+}
+
+// LastSeen records when a tracker was last heard from
+type LastSeen interface {
+	Touch(deviceID string)
+}
+
+type Options struct {
+	Log           *logger.Log
+	Address       string
+	Authenticator Authenticator
+	Registerer    Registerer
+	LastSeen      LastSeen
+}
+
+// Broker is an MQTT broker embedded in the backend, a lighter alternative
+// to an HTTPS request per position for trackers on flaky connections
+type Broker struct {
+	server *mochi.Server
+	log    *logger.Log
+}
+
+// New creates the broker. Without an address no listener is opened and
+// positions can only be published in-process, through Publish.
+func New(opts *Options) (*Broker, error) {
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(discard{}, nil)),
+	})
+
+	h := &hook{
+		log:      opts.Log,
+		auth:     opts.Authenticator,
+		register: opts.Registerer,
+		lastSeen: opts.LastSeen,
+	}
+	if err := server.AddHook(h, nil); err != nil {
+		return nil, err
+	}
+
+	if opts.Address != "" {
+		tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: opts.Address})
+		if err := server.AddListener(tcp); err != nil {
+			return nil, fmt.Errorf("mqtt listener on %s, %w", opts.Address, err)
+		}
+	}
+
+	return &Broker{server: server, log: opts.Log}, nil
+}
+
+// Start serves the broker in the background
+func (b *Broker) Start() error {
+	return b.server.Serve()
+}
+
+// Publish injects a message as if the tracker had published it, it is
+// processed synchronously
+func (b *Broker) Publish(serial string, payload []byte) error {
+	return b.server.Publish(PositionTopic(serial), payload, false, 1)
+}
+
+func (b *Broker) Close() error {
+	b.log.Info("Stopping MQTT broker...")
+	return b.server.Close()
+}
+
+// PositionTopic is the topic a tracker publishes its positions on
+func PositionTopic(serial string) string {
+	return TopicPrefix + serial + "/" + TopicPosition
+}
+
+// parsePositionTopic returns the serial of a position topic
+func parsePositionTopic(topic string) (string, bool) {
+	rest, ok := strings.CutPrefix(topic, TopicPrefix)
+	if !ok {
+		return "", false
+	}
+	serial, ok := strings.CutSuffix(rest, "/"+TopicPosition)
+	if !ok || serial == "" || strings.ContainsAny(serial, "/+#") {
+		return "", false
+	}
+	return serial, true
+}
+
+// discard silences the broker's own logger, the hook logs what matters
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) {
+	return len(p), nil
+}
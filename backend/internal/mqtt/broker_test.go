@@ -0,0 +1,319 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/config"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/internal/web/webcontext"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+const (
+	testSerial = "tracker1"
+	testToken  = "secret-token"
+)
+
+// fakeDevices accepts a single tracker, until revoked
+type fakeDevices struct {
+	mu      sync.Mutex
+	revoked bool
+}
+
+func (d *fakeDevices) AuthenticateDevice(ctx context.Context, deviceID, token string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.revoked || deviceID != testSerial || token != testToken {
+		return errors.New("invalid credentials")
+	}
+	return nil
+}
+
+func (d *fakeDevices) revoke() {
+	d.mu.Lock()
+	d.revoked = true
+	d.mu.Unlock()
+}
+
+// fakeRegisterer records the points registered and the device they came from
+type fakeRegisterer struct {
+	mu      sync.Mutex
+	devices []string
+	points  []*waypoint.NewWaypointDTO
+}
+
+func (r *fakeRegisterer) Register(ctx context.Context, wcs []*waypoint.NewWaypointDTO) ([]*waypoint.WaypointDTO, error) {
+	deviceID, _ := webcontext.GetDeviceID(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for range wcs {
+		r.devices = append(r.devices, deviceID)
+	}
+	r.points = append(r.points, wcs...)
+	return nil, nil
+}
+
+func (r *fakeRegisterer) registered() ([]string, []*waypoint.NewWaypointDTO) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.devices...), append([]*waypoint.NewWaypointDTO(nil), r.points...)
+}
+
+func newTestBroker(t *testing.T, address string) (*Broker, *fakeDevices, *fakeRegisterer) {
+	t.Helper()
+
+	conf := &config.Config{App: "development"}
+	conf.Logger.Level = "error"
+
+	devices := &fakeDevices{}
+	registerer := &fakeRegisterer{}
+	b, err := New(&Options{
+		Log:           logger.Init(conf),
+		Address:       address,
+		Authenticator: devices,
+		Registerer:    registerer,
+	})
+	if err != nil {
+		t.Fatalf("new broker: %v", err)
+	}
+	if err := b.Start(); err != nil {
+		t.Fatalf("start broker: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b, devices, registerer
+}
+
+func positionPayload(latitude float64) []byte {
+	return fmt.Appendf(nil, `{"latitude":%v,"longitude":14.25,"speed":4,"created_at":%d}`, latitude, time.Now().Unix())
+}
+
+func TestPublishRegistersPositions(t *testing.T) {
+	b, _, registerer := newTestBroker(t, "")
+
+	if err := b.Publish(testSerial, positionPayload(40.85)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	batch := fmt.Appendf(nil, `[%s,%s]`, positionPayload(40.86), positionPayload(40.87))
+	if err := b.Publish(testSerial, batch); err != nil {
+		t.Fatalf("publish batch: %v", err)
+	}
+
+	// Invalid payloads are dropped without reaching Register
+	for _, payload := range [][]byte{
+		[]byte(`not json`),
+		positionPayload(123),
+		[]byte(`{"latitude":40.85,"longitude":14.25}`),
+	} {
+		if err := b.Publish(testSerial, payload); err != nil {
+			t.Fatalf("publish %s: %v", payload, err)
+		}
+	}
+
+	devices, points := registerer.registered()
+	if len(points) != 3 {
+		t.Fatalf("registered %d points, want 3", len(points))
+	}
+	for i, want := range []float64{40.85, 40.86, 40.87} {
+		if points[i].Latitude != want {
+			t.Errorf("point %d latitude %v, want %v", i, points[i].Latitude, want)
+		}
+		if devices[i] != testSerial {
+			t.Errorf("point %d registered for device %q, want %q", i, devices[i], testSerial)
+		}
+	}
+}
+
+func TestConnectionCredentials(t *testing.T) {
+	address := freeAddress(t)
+	_, devices, registerer := newTestBroker(t, address)
+
+	// A wrong token is refused on connect
+	conn := dial(t, address)
+	if code := connect(t, conn, testSerial, "wrong-token"); code == packets.CodeSuccess.Code {
+		t.Fatal("connection with a wrong token accepted")
+	}
+	conn.Close()
+
+	// The tracker publishes on its own topic with its token
+	conn = dial(t, address)
+	defer conn.Close()
+	if code := connect(t, conn, testSerial, testToken); code != packets.CodeSuccess.Code {
+		t.Fatalf("connection refused with code %d", code)
+	}
+	publish(t, conn, PositionTopic(testSerial), 1, positionPayload(40.85))
+	expectPuback(t, conn, 1)
+
+	if devices, points := registerer.registered(); len(points) != 1 || devices[0] != testSerial {
+		t.Fatalf("registered %d points for %v, want 1 for %s", len(points), devices, testSerial)
+	}
+
+	// Credentials are checked again on every message
+	devices.revoke()
+	publish(t, conn, PositionTopic(testSerial), 2, positionPayload(40.86))
+	expectPuback(t, conn, 2)
+
+	if _, points := registerer.registered(); len(points) != 1 {
+		t.Fatalf("registered %d points after the token was revoked, want 1", len(points))
+	}
+}
+
+func TestPublishOnAnotherTrackerTopic(t *testing.T) {
+	address := freeAddress(t)
+	_, _, registerer := newTestBroker(t, address)
+
+	conn := dial(t, address)
+	defer conn.Close()
+	if code := connect(t, conn, testSerial, testToken); code != packets.CodeSuccess.Code {
+		t.Fatalf("connection refused with code %d", code)
+	}
+
+	// MQTT 3.1.1 has no negative acknowledgement, the client is disconnected
+	publish(t, conn, PositionTopic("tracker2"), 1, positionPayload(40.85))
+	if typ, _, err := readPacket(conn); err != nil || typ != packets.Disconnect {
+		t.Fatalf("got packet type %d (%v) after a forbidden publish, want a disconnect", typ, err)
+	}
+	if _, _, err := readPacket(conn); !errors.Is(err, io.EOF) {
+		t.Fatalf("read after the disconnect: %v, want EOF", err)
+	}
+
+	if _, points := registerer.registered(); len(points) != 0 {
+		t.Fatalf("registered %d points published on another tracker topic", len(points))
+	}
+}
+
+// freeAddress returns a local address with a port free for the broker
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func dial(t *testing.T, address string) net.Conn {
+	t.Helper()
+
+	var conn net.Conn
+	var err error
+	// The listener starts in the background
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", address); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// connect sends an MQTT 3.1.1 CONNECT and returns the CONNACK return code
+func connect(t *testing.T, conn net.Conn, username, password string) byte {
+	t.Helper()
+
+	pk := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Connect},
+		ProtocolVersion: 4,
+		Connect: packets.ConnectParams{
+			ProtocolName:     []byte("MQTT"),
+			ClientIdentifier: "test-" + username,
+			Clean:            true,
+			Keepalive:        30,
+			UsernameFlag:     true,
+			Username:         []byte(username),
+			PasswordFlag:     true,
+			Password:         []byte(password),
+		},
+	}
+	var buf bytes.Buffer
+	if err := pk.ConnectEncode(&buf); err != nil {
+		t.Fatalf("encode connect: %v", err)
+	}
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		t.Fatalf("write connect: %v", err)
+	}
+
+	typ, body, err := readPacket(conn)
+	if err != nil {
+		t.Fatalf("read connack: %v", err)
+	}
+	if typ != packets.Connack || len(body) != 2 {
+		t.Fatalf("got packet type %d of %d bytes, want a connack", typ, len(body))
+	}
+	return body[1]
+}
+
+// publish sends a QoS 1 PUBLISH
+func publish(t *testing.T, conn net.Conn, topic string, id uint16, payload []byte) {
+	t.Helper()
+
+	pk := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Publish, Qos: 1},
+		ProtocolVersion: 4,
+		TopicName:       topic,
+		PacketID:        id,
+		Payload:         payload,
+	}
+	var buf bytes.Buffer
+	if err := pk.PublishEncode(&buf); err != nil {
+		t.Fatalf("encode publish: %v", err)
+	}
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		t.Fatalf("write publish: %v", err)
+	}
+}
+
+func expectPuback(t *testing.T, conn net.Conn, id uint16) {
+	t.Helper()
+
+	typ, body, err := readPacket(conn)
+	if err != nil {
+		t.Fatalf("read puback: %v", err)
+	}
+	if typ != packets.Puback || len(body) < 2 || uint16(body[0])<<8|uint16(body[1]) != id {
+		t.Fatalf("got packet type %d %v, want the puback of %d", typ, body, id)
+	}
+}
+
+// readPacket reads a packet and returns its type and the bytes after the
+// fixed header
+func readPacket(conn net.Conn) (byte, []byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(conn, b[:]); err != nil {
+		return 0, nil, err
+	}
+	typ := b[0] >> 4
+
+	length, shift := 0, 0
+	for {
+		if _, err := io.ReadFull(conn, b[:]); err != nil {
+			return 0, nil, err
+		}
+		length |= int(b[0]&0x7f) << shift
+		if b[0]&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return 0, nil, err
+	}
+	return typ, body, nil
+}
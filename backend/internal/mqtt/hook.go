@@ -0,0 +1,128 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/validate"
+	"github.com/antoniosarro/saint-tracker/backend/internal/web/webcontext"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// registerTimeout bounds the processing of a single message
+const registerTimeout = 10 * time.Second
+
+// hook authenticates trackers on connect, restricts them to their own
+// position topic and registers what they publish. The username is the
+// serial number of the tracker and the password its token.
+type hook struct {
+	mochi.HookBase
+	log      *logger.Log
+	auth     Authenticator
+	register Registerer
+	lastSeen LastSeen
+
+	// tokens keeps the token of each connected client so that every message
+	// is checked again, e.g. against a deactivation
+	tokens sync.Map
+}
+
+func (h *hook) ID() string {
+	return "saint-tracker"
+}
+
+func (h *hook) Provides(b byte) bool {
+	return bytes.Contains([]byte{
+		mochi.OnConnectAuthenticate,
+		mochi.OnACLCheck,
+		mochi.OnPublish,
+		mochi.OnDisconnect,
+	}, []byte{b})
+}
+
+func (h *hook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	serial := string(pk.Connect.Username)
+	token := string(pk.Connect.Password)
+
+	ctx, cancel := context.WithTimeout(context.Background(), registerTimeout)
+	defer cancel()
+
+	if err := h.auth.AuthenticateDevice(ctx, serial, token); err != nil {
+		h.log.Warnf("MQTT connection of %s refused, %v", serial, err)
+		return false
+	}
+
+	h.tokens.Store(cl.ID, token)
+	h.log.Infof("MQTT client %s connected as device %s", cl.ID, serial)
+	return true
+}
+
+// OnACLCheck only lets a tracker publish on its own position topic
+func (h *hook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	if !write {
+		return false
+	}
+	serial, ok := parsePositionTopic(topic)
+	return ok && serial == string(cl.Properties.Username)
+}
+
+func (h *hook) OnDisconnect(cl *mochi.Client, err error, expire bool) {
+	h.tokens.Delete(cl.ID)
+}
+
+func (h *hook) OnPublish(cl *mochi.Client, pk packets.Packet) (packets.Packet, error) {
+	serial, ok := parsePositionTopic(pk.TopicName)
+	if !ok {
+		return pk, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), registerTimeout)
+	defer cancel()
+
+	// In-process publishes are trusted, trackers are checked again on every
+	// message
+	if !cl.Net.Inline {
+		token, _ := h.tokens.Load(cl.ID)
+		tokenStr, _ := token.(string)
+		if err := h.auth.AuthenticateDevice(ctx, serial, tokenStr); err != nil {
+			h.log.Warnf("MQTT message of %s rejected, %v", serial, err)
+			return pk, packets.ErrNotAuthorized
+		}
+		ctx = webcontext.SetAccessToken(ctx, tokenStr)
+	}
+	ctx = webcontext.SetDeviceID(ctx, serial)
+
+	if err := h.handle(ctx, pk.Payload); err != nil {
+		h.log.Warnf("MQTT message of %s dropped, %v", serial, err)
+		return pk, nil
+	}
+
+	if h.lastSeen != nil {
+		h.lastSeen.Touch(serial)
+	}
+	return pk, nil
+}
+
+// handle decodes, validates and registers a payload, accepted in the same
+// formats as the register endpoint
+func (h *hook) handle(ctx context.Context, payload []byte) error {
+	dtos, _, err := waypoint.DecodeNewWaypoints(payload)
+	if err != nil {
+		return fmt.Errorf("invalid JSON payload, %w", err)
+	}
+
+	for i, dto := range dtos {
+		if err := dto.Validate(); err != nil {
+			return fmt.Errorf("invalid item %d, %v", i, validate.SplitErrors(err))
+		}
+	}
+
+	_, err = h.register.Register(ctx, dtos)
+	return err
+}
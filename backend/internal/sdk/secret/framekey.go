@@ -0,0 +1,20 @@
+package secret
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// frameKeyLabel separates the frame key from any other use of the token
+const frameKeyLabel = "saint-tracker frame key"
+
+// FrameKey derives the key that signs the binary position frames of a
+// tracker, HMAC-SHA256 keyed by the label over the token and hex encoded.
+// Only the hash of the token is stored, so the server keeps this derived
+// key instead, the firmware computes the same from its token.
+func FrameKey(token string) string {
+	mac := hmac.New(sha256.New, []byte(frameKeyLabel))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
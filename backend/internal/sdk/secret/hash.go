@@ -0,0 +1,70 @@
+package secret
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	hashScheme = "sha256"
+	saltLength = 16
+)
+
+// HashToken returns a salted SHA-256 hash of the token encoded as
+// "sha256$<salt>$<hash>". Device tokens are long random strings, so a fast
+// hash is enough and keeps per-request verification cheap.
+func HashToken(token string) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return encode(salt, digest(salt, token)), nil
+}
+
+// VerifyToken reports whether token matches the encoded hash. The
+// comparison runs in constant time.
+func VerifyToken(token, encoded string) bool {
+	salt, sum, ok := decode(encoded)
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare(digest(salt, token), sum) == 1
+}
+
+// IsHashed reports whether the stored value is already a token hash rather
+// than a legacy plaintext token
+func IsHashed(stored string) bool {
+	_, _, ok := decode(stored)
+	return ok
+}
+
+func digest(salt []byte, token string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(token))
+	return h.Sum(nil)
+}
+
+func encode(salt, sum []byte) string {
+	return hashScheme + "$" + hex.EncodeToString(salt) + "$" + hex.EncodeToString(sum)
+}
+
+func decode(encoded string) ([]byte, []byte, bool) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 3 || parts[0] != hashScheme {
+		return nil, nil, false
+	}
+
+	salt, err := hex.DecodeString(parts[1])
+	if err != nil || len(salt) != saltLength {
+		return nil, nil, false
+	}
+	sum, err := hex.DecodeString(parts[2])
+	if err != nil || len(sum) != sha256.Size {
+		return nil, nil, false
+	}
+	return salt, sum, true
+}
@@ -0,0 +1,25 @@
+package secret
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// TokenLength matches the length of the tokens flashed on the trackers
+const TokenLength = 64
+
+// GenerateToken returns a random alphanumeric token of the given length
+func GenerateToken(length int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b), nil
+}
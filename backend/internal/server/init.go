@@ -2,9 +2,12 @@ package server
 
 import (
 	"context"
+	"io"
 
 	"github.com/antoniosarro/saint-tracker/backend/config"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/secret"
 	"github.com/antoniosarro/saint-tracker/backend/internal/web"
+	"github.com/antoniosarro/saint-tracker/backend/internal/web/middlewares"
 	"github.com/antoniosarro/saint-tracker/backend/internal/websocket"
 	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
 	"github.com/jmoiron/sqlx"
@@ -20,12 +23,32 @@ type Options struct {
 type Server struct {
 	Echo *echo.Echo
 	hub  *websocket.Hub
+	mid  *middlewares.Middleware
 	log  *logger.Log
+
+	// listeners are the ingestion endpoints served outside of Echo
+	listeners []io.Closer
 }
 
 func Init(opts *Options) *Server {
+	// Without a configured secret operator tokens are signed with a random
+	// key and become invalid on restart
+	if opts.ServerCfg.Auth.JWTSecret == "" {
+		key, err := secret.GenerateToken(secret.TokenLength)
+		if err != nil {
+			panic("generate jwt secret error, " + err.Error())
+		}
+		opts.ServerCfg.Auth.JWTSecret = key
+		opts.Log.Warn("AUTH_JWTSECRET not set, using a random secret, operator sessions will not survive a restart")
+	}
+
 	// Initialize WebSocket hub
-	hub := websocket.NewHub(opts.Log, opts.ServerCfg.Server.AllowedOrigins)
+	hub := websocket.NewHub(opts.Log, opts.ServerCfg.Server.AllowedOrigins, websocket.Heartbeat{
+		PingInterval: opts.ServerCfg.WebSocket.PingInterval,
+		PongWait:     opts.ServerCfg.WebSocket.PongWait,
+		WriteWait:    opts.ServerCfg.WebSocket.WriteWait,
+		IdleTimeout:  opts.ServerCfg.WebSocket.IdleTimeout,
+	})
 
 	// Start the hub in a goroutine
 	go hub.Start(context.Background())
@@ -41,12 +64,14 @@ func Init(opts *Options) *Server {
 	w.EnableGlobalMiddleware()
 
 	// Setup routes with WebSocket hub
-	router(w, opts, hub)
+	listeners := router(w, opts, hub)
 
 	return &Server{
-		Echo: w.Echo,
-		hub:  hub,
-		log:  opts.Log,
+		Echo:      w.Echo,
+		hub:       hub,
+		mid:       w.Mid,
+		log:       opts.Log,
+		listeners: listeners,
 	}
 }
 
@@ -54,7 +79,17 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	s.log.Info("Shutting down WebSocket hub...")
 	// The hub will stop when its context is cancelled
 	// You might want to add a proper shutdown mechanism here
-	return s.Echo.Shutdown(ctx)
+	for _, l := range s.listeners {
+		if err := l.Close(); err != nil {
+			s.log.Errorf("closing listener error, %v", err)
+		}
+	}
+	err := s.Echo.Shutdown(ctx)
+
+	// Flush device last seen timestamps once no request is in flight
+	s.mid.Close()
+
+	return err
 }
 
 func (s *Server) Close() error {
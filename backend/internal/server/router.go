@@ -1,20 +1,41 @@
 package server
 
 import (
+	"context"
+	"io"
 	"time"
 
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/device/devicerepo"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/device/deviceuc"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/device/deviceweb"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event/eventrepo"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event/eventuc"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/event/eventweb"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator/operatorrepo"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator/operatoruc"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator/operatorweb"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop/stoprepo"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop/stopuc"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop/stopweb"
 	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint/waypointrepo"
 	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint/waypointuc"
 	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint/waypointweb"
+	"github.com/antoniosarro/saint-tracker/backend/internal/mqtt"
+	"github.com/antoniosarro/saint-tracker/backend/internal/udp"
 	"github.com/antoniosarro/saint-tracker/backend/internal/web"
 	"github.com/antoniosarro/saint-tracker/backend/internal/websocket"
 	"github.com/antoniosarro/saint-tracker/backend/internal/websocket/websocketweb"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/mapmatch"
 	"github.com/labstack/echo/v4"
 )
 
 var startTime = time.Now()
 
-func router(w *web.Web, cfg *Options, hub *websocket.Hub) {
+// router registers the routes and starts the extra ingestion listeners,
+// which are returned so that they can be closed on shutdown
+func router(w *web.Web, cfg *Options, hub *websocket.Hub) []io.Closer {
+	var closers []io.Closer
+
 	// Backend details endpoint on root path
 	w.Echo.GET("/", func(c echo.Context) error {
 
@@ -34,9 +55,76 @@ func router(w *web.Web, cfg *Options, hub *websocket.Hub) {
 		return c.JSON(200, map[string]string{"status": "ok"})
 	})
 
-	// Initialize waypoint components with WebSocket broadcaster
+	// Initialize operator components
+	operatorDBRepository := operatorrepo.NewDB(cfg.DB)
+	operatorUseCase := operatoruc.New(cfg.ServerCfg, cfg.Log, operatorDBRepository)
+	if err := operatorUseCase.EnsureAdmin(context.Background()); err != nil {
+		cfg.Log.Errorf("creating bootstrap admin failed, %v", err)
+	}
+
+	// Setup authentication and operator routes
+	operatorweb.Route(w, &operatorweb.Options{
+		Log:             cfg.Log,
+		OperatorUseCase: operatorUseCase,
+	})
+
+	// Initialize device components
+	deviceDBRepository := devicerepo.NewDB(cfg.DB)
+	deviceUseCase := deviceuc.New(cfg.ServerCfg, cfg.Log, deviceDBRepository, w.Mid.DeviceCache(), w.Mid.LastSeen())
+	if err := deviceUseCase.HashLegacyTokens(context.Background()); err != nil {
+		cfg.Log.Errorf("hashing legacy device tokens failed, %v", err)
+	}
+
+	// Setup device management routes
+	deviceweb.Route(w, &deviceweb.Options{
+		Log:           cfg.Log,
+		DeviceUseCase: deviceUseCase,
+	})
+
+	// Initialize event components
+	eventDBRepository := eventrepo.NewDB(cfg.DB)
+	eventUseCase := eventuc.New(cfg.ServerCfg, cfg.Log, eventDBRepository)
+
+	// Initialize stop components
+	stopDBRepository := stoprepo.NewDB(cfg.DB)
+	stopUseCase := stopuc.New(cfg.ServerCfg, cfg.Log, stopDBRepository, eventDBRepository, hub)
+
+	// Setup planned stop routes
+	stopweb.Route(w, &stopweb.Options{
+		Log:         cfg.Log,
+		StopUseCase: stopUseCase,
+	})
+
+	// Load the road network the tracks are snapped to
+	var matcher *mapmatch.Matcher
+	if mm := cfg.ServerCfg.MapMatch; mm.Roads != "" {
+		graph, err := mapmatch.LoadFile(mm.Roads)
+		if err != nil {
+			cfg.Log.Errorf("loading road network failed, map matching disabled, %v", err)
+		} else {
+			cfg.Log.Infof("road network loaded with %d nodes and %d segments", graph.Nodes(), graph.Edges())
+			matcher = mapmatch.New(graph, mapmatch.Options{
+				Radius: mm.Radius,
+				Sigma:  mm.Sigma,
+				Beta:   mm.Beta,
+			})
+		}
+	}
+
+	// Initialize waypoint components with stop detection, WebSocket broadcaster
+	// and map matching
 	waypointDBRepository := waypointrepo.NewDB(cfg.DB)
-	waypointUseCase := waypointuc.New(cfg.ServerCfg, cfg.Log, waypointDBRepository, hub)
+	waypointUseCase := waypointuc.New(cfg.ServerCfg, cfg.Log, waypointDBRepository, eventDBRepository, stopUseCase, hub, matcher)
+	if err := waypointUseCase.RestorePositions(context.Background()); err != nil {
+		cfg.Log.Errorf("restoring tracker positions failed, %v", err)
+	}
+
+	// Setup event routes, statistics come from the waypoint tracks
+	eventweb.Route(w, &eventweb.Options{
+		Log:          cfg.Log,
+		EventUseCase: eventUseCase,
+		StatsUseCase: waypointUseCase,
+	})
 
 	// Setup waypoint routes
 	waypointweb.Route(w, &waypointweb.Options{
@@ -46,7 +134,48 @@ func router(w *web.Web, cfg *Options, hub *websocket.Hub) {
 
 	// Setup WebSocket routes
 	websocketweb.Route(w, &websocketweb.Options{
-		Log: cfg.Log,
-		Hub: hub,
+		Log:             cfg.Log,
+		Hub:             hub,
+		SnapshotUseCase: waypointUseCase,
 	})
+
+	// Start the MQTT broker, positions go through the same waypoint path
+	if cfg.ServerCfg.MQTT.Enabled {
+		broker, err := mqtt.New(&mqtt.Options{
+			Log:           cfg.Log,
+			Address:       cfg.ServerCfg.MQTT.Address,
+			Authenticator: w.Mid,
+			Registerer:    waypointUseCase,
+			LastSeen:      w.Mid.LastSeen(),
+		})
+		if err == nil {
+			err = broker.Start()
+		}
+		if err != nil {
+			cfg.Log.Errorf("starting MQTT broker failed, %v", err)
+		} else {
+			cfg.Log.Infof("MQTT broker listening on %s", cfg.ServerCfg.MQTT.Address)
+			closers = append(closers, broker)
+		}
+	}
+
+	// Start the binary UDP listener for low-bandwidth trackers
+	if cfg.ServerCfg.UDP.Enabled {
+		listener, err := udp.New(&udp.Options{
+			Log:           cfg.Log,
+			Address:       cfg.ServerCfg.UDP.Address,
+			Authenticator: w.Mid,
+			Registerer:    waypointUseCase,
+			LastSeen:      w.Mid.LastSeen(),
+		})
+		if err != nil {
+			cfg.Log.Errorf("starting UDP listener failed, %v", err)
+		} else {
+			listener.Start()
+			cfg.Log.Infof("UDP listener on %s", listener.Addr())
+			closers = append(closers, listener)
+		}
+	}
+
+	return closers
 }
@@ -0,0 +1,171 @@
+// Package udp receives positions from trackers as compact signed binary
+// frames, for trackers on which JSON over HTTPS costs too much battery.
+//
+// A position frame carries one or more points. All integers are big endian:
+//
+//	magic    2   "ST"
+//	version  1   1
+//	type     1   1 for a position frame
+//	serial   1+n length of the serial number, then the serial number
+//	seq      4   sequence number, kept by the tracker across reboots
+//	count    1   number of points, 1 to MaxPoints
+//	points   14 each
+//	  time   4   unix timestamp in seconds
+//	  lat    4   signed, in 1e-7 degrees
+//	  lng    4   signed, in 1e-7 degrees
+//	  speed  2   km/h
+//	mac      16  HMAC-SHA256 of all the previous bytes truncated to 16 bytes,
+//	             keyed with the frame key derived from the device token
+//
+// Every authenticated frame is answered with an ACK, signed the same way:
+//
+//	magic 2, version 1, type 1 (2 for an ACK), seq 4, status 1, mac 16
+//
+// The status is 0 when the points were stored, 1 for a frame already
+// received and 2 when the points failed validation. Status 3 is reserved,
+// it once marked frames older than the sequence window, which are now
+// stored like the others.
+//
+// Once acknowledged, whatever the status, the tracker can drop the points
+// from its cache, resending them would not change the outcome.
+package udp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+)
+
+// Frame constants
+const (
+	Version = 1
+
+	TypePosition = 1
+	TypeAck      = 2
+
+	// MaxPoints keeps a frame within a single unfragmented datagram
+	MaxPoints = 64
+
+	macSize    = 16
+	headerSize = 4
+	pointSize  = 14
+	coordScale = 1e7
+)
+
+var magic = [2]byte{'S', 'T'}
+
+// ACK statuses
+const (
+	// AckOK means the points were stored
+	AckOK byte = 0
+	// AckDuplicate means the frame was already received
+	AckDuplicate byte = 1
+	// AckRejected means the points failed validation
+	AckRejected byte = 2
+)
+
+var (
+	ErrFrameTooShort = errors.New("frame too short")
+	ErrFrameMagic    = errors.New("not a saint-tracker frame")
+	ErrFrameVersion  = errors.New("unsupported frame version")
+	ErrFrameType     = errors.New("unexpected frame type")
+	ErrFrameLength   = errors.New("frame length does not match its point count")
+)
+
+// Frame is a decoded position frame. The signature is not checked by
+// DecodeFrame, see Verify.
+type Frame struct {
+	Serial string
+	Seq    uint32
+	Points []*waypoint.NewWaypointDTO
+
+	signed []byte
+	mac    []byte
+}
+
+// DecodeFrame parses a position frame
+func DecodeFrame(b []byte) (*Frame, error) {
+	if len(b) < headerSize+1 {
+		return nil, ErrFrameTooShort
+	}
+	if b[0] != magic[0] || b[1] != magic[1] {
+		return nil, ErrFrameMagic
+	}
+	if b[2] != Version {
+		return nil, ErrFrameVersion
+	}
+	if b[3] != TypePosition {
+		return nil, ErrFrameType
+	}
+
+	n := int(b[headerSize])
+	off := headerSize + 1 + n
+	if n == 0 || len(b) < off+5 {
+		return nil, ErrFrameTooShort
+	}
+	f := &Frame{
+		Serial: string(b[headerSize+1 : off]),
+		Seq:    binary.BigEndian.Uint32(b[off:]),
+	}
+	count := int(b[off+4])
+	off += 5
+
+	if count == 0 || count > MaxPoints || len(b) != off+count*pointSize+macSize {
+		return nil, ErrFrameLength
+	}
+
+	f.Points = make([]*waypoint.NewWaypointDTO, 0, count)
+	for i := 0; i < count; i++ {
+		p := b[off : off+pointSize]
+		f.Points = append(f.Points, &waypoint.NewWaypointDTO{
+			CreatedAt: int64(binary.BigEndian.Uint32(p[0:])),
+			Latitude:  float64(int32(binary.BigEndian.Uint32(p[4:]))) / coordScale,
+			Longitude: float64(int32(binary.BigEndian.Uint32(p[8:]))) / coordScale,
+			Speed:     int(binary.BigEndian.Uint16(p[12:])),
+		})
+		off += pointSize
+	}
+
+	f.signed = b[:off]
+	f.mac = b[off:]
+	return f, nil
+}
+
+// Verify reports whether the frame was signed with key
+func (f *Frame) Verify(key []byte) bool {
+	return hmac.Equal(sign(key, f.signed), f.mac)
+}
+
+// EncodeFrame builds a signed position frame, the counterpart of
+// DecodeFrame as implemented by the firmware
+func EncodeFrame(key []byte, serial string, seq uint32, points []*waypoint.NewWaypointDTO) []byte {
+	b := []byte{magic[0], magic[1], Version, TypePosition, byte(len(serial))}
+	b = append(b, serial...)
+	b = binary.BigEndian.AppendUint32(b, seq)
+	b = append(b, byte(len(points)))
+	for _, p := range points {
+		b = binary.BigEndian.AppendUint32(b, uint32(p.CreatedAt))
+		b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(p.Latitude*coordScale))))
+		b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(p.Longitude*coordScale))))
+		b = binary.BigEndian.AppendUint16(b, uint16(p.Speed))
+	}
+	return append(b, sign(key, b)...)
+}
+
+// EncodeAck builds the signed ACK of a frame
+func EncodeAck(key []byte, seq uint32, status byte) []byte {
+	b := []byte{magic[0], magic[1], Version, TypeAck}
+	b = binary.BigEndian.AppendUint32(b, seq)
+	b = append(b, status)
+	return append(b, sign(key, b)...)
+}
+
+func sign(key, b []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return mac.Sum(nil)[:macSize]
+}
@@ -0,0 +1,187 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/validate"
+	"github.com/antoniosarro/saint-tracker/backend/internal/web/webcontext"
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+)
+
+// registerTimeout bounds the processing of a single frame
+const registerTimeout = 10 * time.Second
+
+// maxDatagram fits the largest valid frame
+const maxDatagram = headerSize + 1 + 255 + 5 + MaxPoints*pointSize + macSize
+
+// Authenticator checks the signature of a frame against the keys of the
+// tracker
+type Authenticator interface {
+	AuthenticateFrame(ctx context.Context, deviceID string, verify func(key []byte) bool) error
+}
+
+// Registerer stores the waypoints received from a tracker
+type Registerer interface {
+	Register(ctx context.Context, wcs []*waypoint.NewWaypointDTO) ([]*waypoint.WaypointDTO, error)
+}
+
+// LastSeen records when a tracker was last heard from
+type LastSeen interface {
+	Touch(deviceID string)
+}
+
+type Options struct {
+	Log           *logger.Log
+	Address       string
+	Authenticator Authenticator
+	Registerer    Registerer
+	LastSeen      LastSeen
+}
+
+// Server receives position frames on a UDP socket
+type Server struct {
+	conn     *net.UDPConn
+	log      *logger.Log
+	auth     Authenticator
+	register Registerer
+	lastSeen LastSeen
+	windows  *windows
+	wg       sync.WaitGroup
+}
+
+// New binds the UDP socket, frames are read once Start is called
+func New(opts *Options) (*Server, error) {
+	addr, err := net.ResolveUDPAddr("udp", opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		conn:     conn,
+		log:      opts.Log,
+		auth:     opts.Authenticator,
+		register: opts.Registerer,
+		lastSeen: opts.LastSeen,
+		windows:  newWindows(),
+	}, nil
+}
+
+// Addr is the address the server listens on
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Start reads frames in the background until Close. Frames are handled one
+// at a time, in the order they arrive.
+func (s *Server) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		buf := make([]byte, maxDatagram+1)
+		for {
+			n, addr, err := s.conn.ReadFromUDP(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				s.log.Errorf("UDP read error, %v", err)
+				continue
+			}
+			s.handle(buf[:n], addr)
+		}
+	}()
+}
+
+func (s *Server) Close() error {
+	s.log.Info("Stopping UDP listener...")
+	err := s.conn.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) handle(b []byte, addr *net.UDPAddr) {
+	f, err := DecodeFrame(b)
+	if err != nil {
+		s.log.Warnf("UDP datagram from %s dropped, %v", addr, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), registerTimeout)
+	defer cancel()
+
+	// Keep the key the frame was signed with, the ACK is signed with it too
+	var key []byte
+	err = s.auth.AuthenticateFrame(ctx, f.Serial, func(k []byte) bool {
+		if f.Verify(k) {
+			key = k
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		s.log.Warnf("UDP frame of %s from %s rejected, %v", f.Serial, addr, err)
+		return
+	}
+	s.lastSeen.Touch(f.Serial)
+
+	status := s.process(ctx, f)
+	if status < 0 {
+		// Not acknowledged, the tracker will resend the frame
+		return
+	}
+	if _, err := s.conn.WriteToUDP(EncodeAck(key, f.Seq, byte(status)), addr); err != nil {
+		s.log.Errorf("UDP ack to %s error, %v", addr, err)
+	}
+}
+
+// process registers the points of an authenticated frame and returns the
+// ACK status, or -1 when the frame should be resent
+func (s *Server) process(ctx context.Context, f *Frame) int {
+	for i, p := range f.Points {
+		if err := p.Validate(); err != nil {
+			s.log.Warnf("UDP frame %d of %s rejected, invalid point %d, %v", f.Seq, f.Serial, i, validate.SplitErrors(err))
+			return int(AckRejected)
+		}
+	}
+
+	// A frame too old for the window, e.g. from a large offline cache
+	// flushed after newer ones, is still registered: the tracker drops the
+	// points once acknowledged, and resent ones are recognised as
+	// duplicates by Register
+	switch s.windows.accept(f.Serial, f.Seq) {
+	case seqDuplicate:
+		return int(AckDuplicate)
+	case seqStale:
+		s.log.Infof("UDP frame %d of %s older than the sequence window", f.Seq, f.Serial)
+	}
+
+	ctx = webcontext.SetDeviceID(ctx, f.Serial)
+	waypoints, err := s.register.Register(ctx, f.Points)
+	if err != nil {
+		s.windows.forget(f.Serial, f.Seq)
+		s.log.Errorf("UDP frame %d of %s not stored, %v", f.Seq, f.Serial, err)
+		return -1
+	}
+
+	// The points may have reached the server before, e.g. over HTTP, or
+	// been refused by the quality filter
+	status := AckRejected
+	for _, w := range waypoints {
+		if w.Duplicate {
+			status = AckDuplicate
+		} else if !w.Rejected {
+			return int(AckOK)
+		}
+	}
+	return int(status)
+}
@@ -0,0 +1,103 @@
+package udp
+
+import "sync"
+
+// windowSize is how far behind the highest sequence number a frame can
+// arrive and still be told apart from a duplicate
+const windowSize = 1024
+
+// seqResult is the outcome of checking a sequence number
+type seqResult int
+
+const (
+	seqFresh seqResult = iota
+	seqDuplicate
+	seqStale
+)
+
+// window tracks the sequence numbers received from a tracker, as a bitmap
+// of the last windowSize numbers below the highest one
+type window struct {
+	started bool
+	top     uint32
+	bits    [windowSize / 64]uint64
+}
+
+// accept checks seq and marks it as received when it is fresh
+func (w *window) accept(seq uint32) seqResult {
+	if !w.started || seq > w.top {
+		w.advance(seq)
+		w.set(seq)
+		return seqFresh
+	}
+
+	if w.top-seq >= windowSize {
+		return seqStale
+	}
+	if w.has(seq) {
+		return seqDuplicate
+	}
+	w.set(seq)
+	return seqFresh
+}
+
+// forget unmarks seq, so that a frame that could not be stored is accepted
+// again when the tracker resends it
+func (w *window) forget(seq uint32) {
+	if w.started && w.top-seq < windowSize {
+		w.bits[seq%windowSize/64] &^= 1 << (seq % 64)
+	}
+}
+
+// advance moves the top of the window to seq, clearing the numbers it
+// skips over
+func (w *window) advance(seq uint32) {
+	if !w.started || seq-w.top >= windowSize {
+		w.bits = [windowSize / 64]uint64{}
+	} else {
+		for s := w.top + 1; s != seq; s++ {
+			w.bits[s%windowSize/64] &^= 1 << (s % 64)
+		}
+	}
+	w.started = true
+	w.top = seq
+}
+
+func (w *window) set(seq uint32) {
+	w.bits[seq%windowSize/64] |= 1 << (seq % 64)
+}
+
+func (w *window) has(seq uint32) bool {
+	return w.bits[seq%windowSize/64]&(1<<(seq%64)) != 0
+}
+
+// windows keeps a window per tracker
+type windows struct {
+	mu      sync.Mutex
+	devices map[string]*window
+}
+
+func newWindows() *windows {
+	return &windows{devices: make(map[string]*window)}
+}
+
+func (ws *windows) accept(serial string, seq uint32) seqResult {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	w, ok := ws.devices[serial]
+	if !ok {
+		w = new(window)
+		ws.devices[serial] = w
+	}
+	return w.accept(seq)
+}
+
+func (ws *windows) forget(serial string, seq uint32) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if w, ok := ws.devices[serial]; ok {
+		w.forget(seq)
+	}
+}
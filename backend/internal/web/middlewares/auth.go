@@ -1,9 +1,17 @@
 package middlewares
 
 import (
+	"context"
+	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/operator"
 	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/jwtauth"
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/secret"
 	"github.com/antoniosarro/saint-tracker/backend/internal/web/webcontext"
 	"github.com/labstack/echo/v4"
 )
@@ -27,42 +35,227 @@ func (mid *Middleware) Authenticated(next echo.HandlerFunc) echo.HandlerFunc {
 			return e
 		}
 
-		// Try to get device info from cache first
-		var validToken string
-		if cachedInfo, found := mid.deviceCache.Get(deviceID); found {
-			validToken = cachedInfo.Token
-		} else {
-			query := `SELECT token FROM esp32_devices WHERE serial_number = $1`
-			row := mid.db.QueryRowxContext(c.Request().Context(), query, deviceID)
+		return mid.serveDevice(c, next, deviceID, token)
+	}
+}
 
-			var device struct {
-				Token string `db:"token"`
-			}
+// AuthenticatedByQuery authenticates trackers that cannot set headers, such
+// as phone apps speaking the OsmAnd protocol, by the id and token request
+// parameters. The headers are still honoured when present.
+func (mid *Middleware) AuthenticatedByQuery(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := c.Request().Header.Get("X-Header-Token")
+		if token == "" {
+			token = c.FormValue("token")
+		}
+		if token == "" {
+			e := httperrors.New(httperrors.Unauthenticated, "Token missing")
+			e.AddDetail("token parameter or X-Header-Token header is required")
+			return e
+		}
+
+		deviceID := c.FormValue("id")
+		if deviceID == "" {
+			deviceID = c.Request().Header.Get("X-Header-Device")
+		}
+		if deviceID == "" {
+			e := httperrors.New(httperrors.Unauthenticated, "Device id missing")
+			e.AddDetail("id parameter or X-Header-Device header is required")
+			return e
+		}
+
+		return mid.serveDevice(c, next, deviceID, token)
+	}
+}
+
+// serveDevice authenticates the tracker, then serves the request on its
+// behalf and records that it was seen
+func (mid *Middleware) serveDevice(c echo.Context, next echo.HandlerFunc, deviceID, token string) error {
+	if err := mid.AuthenticateDevice(c.Request().Context(), deviceID, token); err != nil {
+		return err
+	}
+
+	ctx := webcontext.SetDeviceID(c.Request().Context(), deviceID)
+	ctx = webcontext.SetAccessToken(ctx, token)
+
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	if err := next(c); err != nil {
+		return err
+	}
+
+	mid.lastSeen.Touch(deviceID)
+	return nil
+}
+
+// AuthenticateDevice checks the token of a tracker and that the tracker is
+// still active. It backs every ingestion channel, not only HTTP.
+func (mid *Middleware) AuthenticateDevice(ctx context.Context, deviceID, token string) error {
+	info, err := mid.deviceInfo(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+
+	if !info.matches(token) {
+		e := httperrors.New(httperrors.Unauthenticated, "Invalid token for device")
+		e.AddDetail("Token does not match device")
+		return e
+	}
+
+	return info.checkActive()
+}
+
+// AuthenticateFrame checks a signed binary frame of a tracker. verify is
+// called with the keys the tracker may currently sign with and reports
+// whether the signature matches.
+func (mid *Middleware) AuthenticateFrame(ctx context.Context, deviceID string, verify func(key []byte) bool) error {
+	info, err := mid.deviceInfo(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+
+	if !info.matchesFrame(verify) {
+		e := httperrors.New(httperrors.Unauthenticated, "Invalid frame signature for device")
+		e.AddDetail("Frame signature does not match device")
+		return e
+	}
 
-			if err := row.StructScan(&device); err != nil {
-				fmt.Println(err)
-				e := httperrors.New(httperrors.Unauthenticated, "esp32 device not valid")
-				e.AddDetail("esp32 device not valid")
+	return info.checkActive()
+}
+
+// deviceInfo returns the credentials of a tracker, from the cache when
+// possible
+func (mid *Middleware) deviceInfo(ctx context.Context, deviceID string) (*DeviceInfo, error) {
+	// Try to get device info from cache first
+	info, found := mid.deviceCache.Get(deviceID)
+	if found {
+		return info, nil
+	}
+
+	query := `SELECT token, previous_token, previous_token_expires_at, frame_key, previous_frame_key, is_active FROM esp32_devices WHERE serial_number = $1`
+	row := mid.db.QueryRowxContext(ctx, query, deviceID)
+
+	var device struct {
+		Token                  string         `db:"token"`
+		PreviousToken          sql.NullString `db:"previous_token"`
+		PreviousTokenExpiresAt sql.NullTime   `db:"previous_token_expires_at"`
+		FrameKey               sql.NullString `db:"frame_key"`
+		PreviousFrameKey       sql.NullString `db:"previous_frame_key"`
+		IsActive               bool           `db:"is_active"`
+	}
+
+	if err := row.StructScan(&device); err != nil {
+		fmt.Println(err)
+		e := httperrors.New(httperrors.Unauthenticated, "esp32 device not valid")
+		e.AddDetail("esp32 device not valid")
+		return nil, e
+	}
+
+	info = &DeviceInfo{
+		Token:                  device.Token,
+		PreviousToken:          device.PreviousToken.String,
+		PreviousTokenExpiresAt: device.PreviousTokenExpiresAt.Time,
+		FrameKey:               decodeFrameKey(device.FrameKey.String),
+		PreviousFrameKey:       decodeFrameKey(device.PreviousFrameKey.String),
+		IsActive:               device.IsActive,
+	}
+
+	// Cache the result
+	mid.deviceCache.Set(deviceID, *info)
+	return info, nil
+}
+
+// RequireRole authenticates operators by their bearer token and rejects
+// those whose role is below the required one
+func (mid *Middleware) RequireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, found := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !found || token == "" {
+				e := httperrors.New(httperrors.Unauthenticated, "Authorization missing")
+				e.AddDetail("Authorization header with a Bearer token is required")
 				return e
 			}
 
-			validToken = device.Token
+			claims, err := jwtauth.Parse([]byte(mid.conf.Auth.JWTSecret), token)
+			if err != nil {
+				return httperrors.New(httperrors.Unauthenticated, "Invalid or expired access token")
+			}
 
-			// Cache the result
-			mid.deviceCache.Set(deviceID, validToken)
-		}
+			// Read role and status from the db so that changes apply
+			// without waiting for the token to expire
+			query := `SELECT username, role, is_active FROM operator WHERE id = $1`
+			row := mid.db.QueryRowxContext(c.Request().Context(), query, claims.Subject)
 
-		if token != validToken {
-			e := httperrors.New(httperrors.Unauthenticated, "Invalid token for device")
-			e.AddDetail("Token does not match device")
-			return e
+			var account struct {
+				Username string `db:"username"`
+				Role     string `db:"role"`
+				IsActive bool   `db:"is_active"`
+			}
+
+			if err := row.StructScan(&account); err != nil {
+				return httperrors.New(httperrors.Unauthenticated, "Operator not valid")
+			}
+
+			if !account.IsActive {
+				return httperrors.New(httperrors.PermissionDenied, "Operator account is disabled")
+			}
+
+			if !operator.HasRole(account.Role, role) {
+				return httperrors.New(httperrors.PermissionDenied, fmt.Sprintf("The %s role is required", role))
+			}
+
+			ctx := webcontext.SetOperator(c.Request().Context(), &webcontext.Operator{
+				ID:       claims.Subject,
+				Username: account.Username,
+				Role:     account.Role,
+			})
+			ctx = webcontext.SetAccessToken(ctx, token)
+
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			return next(c)
 		}
+	}
+}
 
-		ctx := webcontext.SetDeviceID(c.Request().Context(), deviceID)
-		ctx = webcontext.SetAccessToken(ctx, token)
+// matches checks the token against the current hash and, while the rotation
+// grace period lasts, against the previous one
+func (info *DeviceInfo) matches(token string) bool {
+	if secret.VerifyToken(token, info.Token) {
+		return true
+	}
+	if info.PreviousToken != "" && time.Now().Before(info.PreviousTokenExpiresAt) {
+		return secret.VerifyToken(token, info.PreviousToken)
+	}
+	return false
+}
 
-		c.SetRequest(c.Request().WithContext(ctx))
+// matchesFrame is matches for frame signatures, trackers whose token was
+// hashed before frame keys existed have none until the token is rotated
+func (info *DeviceInfo) matchesFrame(verify func(key []byte) bool) bool {
+	if len(info.FrameKey) > 0 && verify(info.FrameKey) {
+		return true
+	}
+	if len(info.PreviousFrameKey) > 0 && time.Now().Before(info.PreviousTokenExpiresAt) {
+		return verify(info.PreviousFrameKey)
+	}
+	return false
+}
+
+func (info *DeviceInfo) checkActive() error {
+	if !info.IsActive {
+		e := httperrors.New(httperrors.PermissionDenied, "esp32 device deactivated")
+		e.AddDetail("Device has been deactivated by an administrator")
+		return e
+	}
+	return nil
+}
 
-		return next(c)
+func decodeFrameKey(s string) []byte {
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		return nil
 	}
+	return key
 }
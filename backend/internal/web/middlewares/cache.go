@@ -6,9 +6,14 @@ import (
 )
 
 type DeviceInfo struct {
-	ID        string
-	Token     string
-	ExpiresAt time.Time
+	ID                     string
+	Token                  string
+	PreviousToken          string
+	PreviousTokenExpiresAt time.Time
+	FrameKey               []byte
+	PreviousFrameKey       []byte
+	IsActive               bool
+	ExpiresAt              time.Time
 }
 
 type DeviceCache struct {
@@ -44,15 +49,22 @@ func (dc *DeviceCache) Get(deviceID string) (*DeviceInfo, bool) {
 	return info, true
 }
 
-func (dc *DeviceCache) Set(deviceID string, token string) {
+func (dc *DeviceCache) Set(deviceID string, info DeviceInfo) {
 	dc.mu.Lock()
 	defer dc.mu.Unlock()
 
-	dc.cache[deviceID] = &DeviceInfo{
-		ID:        deviceID,
-		Token:     token,
-		ExpiresAt: time.Now().Add(dc.ttl),
-	}
+	info.ID = deviceID
+	info.ExpiresAt = time.Now().Add(dc.ttl)
+	dc.cache[deviceID] = &info
+}
+
+// Delete drops the cached entry so the next request hits the db, used when
+// a device token is rotated or the device is deactivated
+func (dc *DeviceCache) Delete(deviceID string) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	delete(dc.cache, deviceID)
 }
 
 func (dc *DeviceCache) cleanup() {
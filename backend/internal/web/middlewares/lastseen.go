@@ -0,0 +1,119 @@
+package middlewares
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/jmoiron/sqlx"
+)
+
+// LastSeenRecorder keeps the last contact time of each device in memory and
+// writes them to the db in batches, so SQLite is not hit on every post
+type LastSeenRecorder struct {
+	mu       sync.Mutex
+	pending  map[string]time.Time
+	db       *sqlx.DB
+	log      *logger.Log
+	interval time.Duration
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewLastSeenRecorder(db *sqlx.DB, log *logger.Log, interval time.Duration) *LastSeenRecorder {
+	lr := &LastSeenRecorder{
+		pending:  make(map[string]time.Time),
+		db:       db,
+		log:      log,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+
+	go lr.run()
+
+	return lr
+}
+
+// Touch records that the device has just been heard from
+func (lr *LastSeenRecorder) Touch(deviceID string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	lr.pending[deviceID] = time.Now().UTC()
+}
+
+// Pending returns the last contact time not yet written to the db
+func (lr *LastSeenRecorder) Pending(deviceID string) (time.Time, bool) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	t, ok := lr.pending[deviceID]
+	return t, ok
+}
+
+// Stop writes the pending timestamps and stops the background flush
+func (lr *LastSeenRecorder) Stop() {
+	lr.stopOnce.Do(func() {
+		close(lr.done)
+		lr.flush()
+	})
+}
+
+func (lr *LastSeenRecorder) run() {
+	ticker := time.NewTicker(lr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lr.done:
+			return
+		case <-ticker.C:
+			lr.flush()
+		}
+	}
+}
+
+func (lr *LastSeenRecorder) flush() {
+	lr.mu.Lock()
+	if len(lr.pending) == 0 {
+		lr.mu.Unlock()
+		return
+	}
+	batch := lr.pending
+	lr.pending = make(map[string]time.Time)
+	lr.mu.Unlock()
+
+	if err := lr.write(batch); err != nil {
+		lr.log.Errorf("last seen flush error, %v", err)
+
+		// Put the batch back unless newer values arrived in the meantime
+		lr.mu.Lock()
+		for id, t := range batch {
+			if _, ok := lr.pending[id]; !ok {
+				lr.pending[id] = t
+			}
+		}
+		lr.mu.Unlock()
+	}
+}
+
+func (lr *LastSeenRecorder) write(batch map[string]time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := lr.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE esp32_devices SET last_seen = $1 WHERE serial_number = $2`
+	for id, t := range batch {
+		if _, err := tx.ExecContext(ctx, query, t, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -27,7 +27,7 @@ func (mid *Middleware) RequestLogMiddleware(next echo.HandlerFunc) echo.HandlerF
 		mid.log.Infof("Req ID: %s, Methos: %s, URI: %s, Status: %v, Size: %v, Time: %s",
 			reqId,
 			req.Method,
-			req.RequestURI,
+			redactedURI(req),
 			res.Status,
 			res.Size,
 			since,
@@ -36,6 +36,17 @@ func (mid *Middleware) RequestLogMiddleware(next echo.HandlerFunc) echo.HandlerF
 	}
 }
 
+// redactedURI hides the device token that phone apps send in the query
+// string, so that it does not end up in the logs
+func redactedURI(req *http.Request) string {
+	query := req.URL.Query()
+	if !query.Has("token") {
+		return req.RequestURI
+	}
+	query.Set("token", "redacted")
+	return req.URL.Path + "?" + query.Encode()
+}
+
 func (mid *Middleware) ErrorLogMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		err := next(c)
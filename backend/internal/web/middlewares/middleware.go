@@ -14,6 +14,7 @@ type Middleware struct {
 	log         *logger.Log
 	db          *sqlx.DB
 	deviceCache *DeviceCache
+	lastSeen    *LastSeenRecorder
 }
 
 type MiddlewareFunc func(h http.Handler) http.Handler
@@ -24,5 +25,19 @@ func New(conf *config.Config, log *logger.Log, db *sqlx.DB, cacheTTL time.Durati
 		log:         log,
 		db:          db,
 		deviceCache: NewDeviceCache(cacheTTL),
+		lastSeen:    NewLastSeenRecorder(db, log, conf.Device.LastSeenFlushInterval),
 	}
 }
+
+func (mid *Middleware) DeviceCache() *DeviceCache {
+	return mid.deviceCache
+}
+
+func (mid *Middleware) LastSeen() *LastSeenRecorder {
+	return mid.lastSeen
+}
+
+// Close flushes the state buffered by the middlewares
+func (mid *Middleware) Close() {
+	mid.lastSeen.Stop()
+}
@@ -2,7 +2,6 @@ package web
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/antoniosarro/saint-tracker/backend/config"
 	"github.com/antoniosarro/saint-tracker/backend/internal/web/middlewares"
@@ -28,7 +27,7 @@ func New(log *logger.Log, db *sqlx.DB) *Web {
 }
 
 func (w *Web) InitCustomMiddleware(serverCfg *config.Config) {
-	w.Mid = middlewares.New(serverCfg, w.log, w.db, time.Hour)
+	w.Mid = middlewares.New(serverCfg, w.log, w.db, serverCfg.Device.CacheTTL)
 }
 
 func (w *Web) EnableCORSMiddleware(origins []string) {
@@ -38,6 +37,8 @@ func (w *Web) EnableCORSMiddleware(origins []string) {
 			http.MethodOptions,
 			http.MethodGet,
 			http.MethodPost,
+			http.MethodPut,
+			http.MethodDelete,
 		},
 		// Add the custom headers your auth middleware expects
 		AllowHeaders: []string{
@@ -47,7 +48,7 @@ func (w *Web) EnableCORSMiddleware(origins []string) {
 			"X-Header-Token",  // Required by auth middleware
 			"X-Header-Device", // Required by auth middleware
 		},
-		ExposeHeaders:    []string{"Link"},
+		ExposeHeaders:    []string{"Link", "X-Next-Cursor"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
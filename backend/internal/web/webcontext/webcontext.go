@@ -5,10 +5,18 @@ import "context"
 type contextKey string
 
 const (
-	deviceKey contextKey = "device_key"
-	tokenKey  contextKey = "token_key"
+	deviceKey   contextKey = "device_key"
+	tokenKey    contextKey = "token_key"
+	operatorKey contextKey = "operator_key"
 )
 
+// Operator identifies the authenticated operator of an admin request
+type Operator struct {
+	ID       string
+	Username string
+	Role     string
+}
+
 func SetDeviceID(ctx context.Context, deviceID string) context.Context {
 	return context.WithValue(ctx, deviceKey, deviceID)
 }
@@ -16,3 +24,18 @@ func SetDeviceID(ctx context.Context, deviceID string) context.Context {
 func SetAccessToken(ctx context.Context, token string) context.Context {
 	return context.WithValue(ctx, tokenKey, token)
 }
+
+func SetOperator(ctx context.Context, operator *Operator) context.Context {
+	return context.WithValue(ctx, operatorKey, operator)
+}
+
+func GetOperator(ctx context.Context) (*Operator, bool) {
+	operator, ok := ctx.Value(operatorKey).(*Operator)
+	return operator, ok
+}
+
+// GetDeviceID returns the serial number of the authenticated tracker
+func GetDeviceID(ctx context.Context) (string, bool) {
+	deviceID, ok := ctx.Value(deviceKey).(string)
+	return deviceID, ok
+}
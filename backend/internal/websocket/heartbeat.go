@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Default heartbeat, used for the settings left unset
+const (
+	DefaultPingInterval = 30 * time.Second
+	DefaultPongWait     = 60 * time.Second
+	DefaultWriteWait    = 10 * time.Second
+	DefaultIdleTimeout  = 2 * time.Minute
+)
+
+// Heartbeat sets how dead connections are detected. WebSocket clients are
+// pinged every PingInterval and disconnected when nothing, not even a pong,
+// arrives for PongWait. Every write must complete within WriteWait. The hub
+// reaps the clients of any transport silent for IdleTimeout, the backstop
+// for the connections whose pumps are stuck.
+type Heartbeat struct {
+	PingInterval time.Duration
+	PongWait     time.Duration
+	WriteWait    time.Duration
+	IdleTimeout  time.Duration
+}
+
+// withDefaults fills the unset settings. A pong wait shorter than the ping
+// interval would drop every quiet client, it is then doubled from it. The
+// idle timeout is raised likewise to at least the pong wait plus a ping
+// interval, so that the reaper never takes a client answering the pings or
+// a stream written to at every interval.
+func (h Heartbeat) withDefaults() Heartbeat {
+	if h.PingInterval <= 0 {
+		h.PingInterval = DefaultPingInterval
+	}
+	if h.PongWait <= 0 {
+		h.PongWait = DefaultPongWait
+	}
+	if h.PongWait <= h.PingInterval {
+		h.PongWait = 2 * h.PingInterval
+	}
+	if h.WriteWait <= 0 {
+		h.WriteWait = DefaultWriteWait
+	}
+	if h.IdleTimeout <= 0 {
+		h.IdleTimeout = DefaultIdleTimeout
+	}
+	if h.IdleTimeout < h.PongWait+h.PingInterval {
+		h.IdleTimeout = h.PongWait + h.PingInterval
+	}
+	return h
+}
+
+// Stats are the connection counters of the hub since it started
+type Stats struct {
+	Clients       int
+	PingsSent     uint64
+	PongsReceived uint64
+	TimedOut      uint64
+	WriteErrors   uint64
+	Reaped        uint64
+	Dropped       uint64
+}
+
+// counters are updated by the pumps and the hub goroutine
+type counters struct {
+	pingsSent     atomic.Uint64
+	pongsReceived atomic.Uint64
+	timedOut      atomic.Uint64
+	writeErrors   atomic.Uint64
+	reaped        atomic.Uint64
+	dropped       atomic.Uint64
+}
+
+// Heartbeat returns the heartbeat settings of the hub
+func (h *Hub) Heartbeat() Heartbeat {
+	return h.heartbeat
+}
+
+// Stats returns the connection counters
+func (h *Hub) Stats() Stats {
+	return Stats{
+		Clients:       h.GetClientCount(),
+		PingsSent:     h.counters.pingsSent.Load(),
+		PongsReceived: h.counters.pongsReceived.Load(),
+		TimedOut:      h.counters.timedOut.Load(),
+		WriteErrors:   h.counters.writeErrors.Load(),
+		Reaped:        h.counters.reaped.Load(),
+		Dropped:       h.counters.dropped.Load(),
+	}
+}
+
+// WriteFailed counts a write that did not complete, for the transports
+// other than WebSocket
+func (h *Hub) WriteFailed() {
+	h.counters.writeErrors.Add(1)
+}
+
+// Seen records activity on the connection: anything read from a WebSocket,
+// or a completed write for the transports the client cannot answer on
+func (c *Client) Seen() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+// reapIdle disconnects the clients silent for longer than the idle timeout.
+// Called from the hub goroutine.
+func (h *Hub) reapIdle() {
+	deadline := time.Now().Add(-h.heartbeat.IdleTimeout).UnixNano()
+
+	var reaped []*Client
+	h.mu.Lock()
+	for client := range h.clients {
+		if client.lastSeen.Load() < deadline {
+			h.removeClient(client)
+			reaped = append(reaped, client)
+		}
+	}
+	clientCount := len(h.clients)
+	h.mu.Unlock()
+
+	for _, client := range reaped {
+		if client.Conn != nil {
+			client.Conn.Close()
+		}
+		h.counters.reaped.Add(1)
+		h.logger.Infof("Client %s reaped after being idle. Total clients: %d", client.ID, clientCount)
+	}
+}
@@ -0,0 +1,47 @@
+package websocket
+
+// ReplayBufferSize is how many broadcast messages the hub keeps for the
+// clients resuming after a reconnection
+const ReplayBufferSize = 512
+
+// history is a ring buffer of the latest broadcast messages, oldest first.
+// It is owned by the hub goroutine.
+type history struct {
+	messages []Message
+	start    int
+	size     int
+}
+
+func newHistory(capacity int) *history {
+	return &history{messages: make([]Message, capacity)}
+}
+
+func (h *history) push(m Message) {
+	if h.size < len(h.messages) {
+		h.messages[(h.start+h.size)%len(h.messages)] = m
+		h.size++
+		return
+	}
+	h.messages[h.start] = m
+	h.start = (h.start + 1) % len(h.messages)
+}
+
+// between returns the messages with an ID after from and up to to. It
+// reports false when some of them were already dropped from the buffer.
+func (h *history) between(from, to uint64) ([]Message, bool) {
+	var res []Message
+	if from >= to {
+		return res, true
+	}
+	if h.size == 0 || h.messages[h.start].seq > from+1 {
+		return nil, false
+	}
+
+	for i := 0; i < h.size; i++ {
+		m := h.messages[(h.start+i)%len(h.messages)]
+		if m.seq > from && m.seq <= to {
+			res = append(res, m)
+		}
+	}
+	return res, true
+}
@@ -2,37 +2,114 @@ package websocket
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
 	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
 	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 // Message types
 const (
 	MessageTypeWaypoint = "waypoint"
+	MessageTypePosition = "position"
 	MessageTypeError    = "error"
 	MessageTypePing     = "ping"
 	MessageTypePong     = "pong"
+
+	// Reconnection: a client asks for the messages it missed with resume,
+	// resync tells it they are no longer buffered and must be fetched again
+	MessageTypeResume = "resume"
+	MessageTypeResync = "resync"
+
+	// The live state sent on connect to the clients asking for it
+	MessageTypeSnapshot = "snapshot"
+
+	// Stop transitions detected from the incoming waypoints
+	MessageTypeStopArrival   = "stop_arrival"
+	MessageTypeStopDeparture = "stop_departure"
+	MessageTypeStopSkipped   = "stop_skipped"
+	MessageTypeStopReset     = "stop_reset"
 )
 
-// WebSocket message structure
+// WebSocket message structure. Broadcast messages carry an EventID that
+// increases with every broadcast, clients resume from the last one they
+// received.
 type Message struct {
 	Type    string      `json:"type"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
 	EventID string      `json:"event_id,omitempty"`
+	Topic   string      `json:"topic,omitempty"`
+
+	// seq is the numeric EventID
+	seq uint64
+	// topics are the events and devices the message is about, empty for
+	// messages that concern every client
+	topics []string
+	// unflagged is the message without the bad fixes, for the clients that
+	// exclude them. It is nil when there were none, and has no type when
+	// nothing is left to send.
+	unflagged *Message
 }
 
-// Client represents a WebSocket connection
+// Client represents a WebSocket connection, or a connection of another
+// transport such as SSE when Conn is nil
 type Client struct {
 	ID     string
 	Conn   *websocket.Conn
 	Send   chan Message
 	Hub    *Hub
 	Logger *logger.Log
+
+	// Scope, when set, subscribes the client to the topic of an event on
+	// connect
+	Scope string
+	// Topics the client is subscribed to on connect
+	Topics []string
+	// ExcludeFlagged leaves out the waypoints flagged as bad fixes
+	ExcludeFlagged bool
+	// LastEventID, when set, replays the messages broadcast after it right
+	// after the connection is registered
+	LastEventID *uint64
+	// Snapshot, when set, is sent right after the welcome message. It must
+	// have been taken at LastEventID so that the replay completes it.
+	Snapshot interface{}
+
+	// joined is the ID of the last message broadcast before the client was
+	// registered, later ones were sent to it live. Messages up to after
+	// are not sent, the client already has them.
+	joined uint64
+	after  uint64
+
+	// topics are the subscriptions of the client, nil until it subscribes
+	// to any, owned by the hub
+	topics map[string]bool
+
+	// lastSeen is the time of the last activity on the connection in
+	// nanoseconds, see Seen
+	lastSeen atomic.Int64
+}
+
+// resumeRequest asks the hub to replay the messages a client missed
+type resumeRequest struct {
+	client *Client
+	after  uint64
+}
+
+// reply is a message for a single client from its reader. It goes through
+// the hub, which owns the Send channel and may have closed it.
+type reply struct {
+	client  *Client
+	message Message
 }
 
 // Hub maintains active clients and broadcasts messages
@@ -41,25 +118,57 @@ type Hub struct {
 	Broadcast  chan Message
 	Register   chan *Client
 	Unregister chan *Client
+	resume     chan resumeRequest
+	replies    chan reply
+	subscribe  chan subscription
 	mu         sync.RWMutex
 	logger     *logger.Log
 	upgrader   websocket.Upgrader
 	ctx        context.Context
 	cancel     context.CancelFunc
+
+	// topics are the clients subscribed to each topic
+	topics map[string]map[*Client]bool
+
+	heartbeat Heartbeat
+	counters  counters
+
+	// seq is the ID of the last message queued for broadcast. IDs are
+	// assigned as messages are queued so that they follow the order of the
+	// changes they report.
+	seqMu sync.Mutex
+	seq   uint64
+
+	// processed is the ID of the last broadcast message and history keeps
+	// the latest ones, both are owned by the hub goroutine
+	processed uint64
+	history   *history
 }
 
 // NewHub creates a new WebSocket hub
-func NewHub(log *logger.Log, allowedOrigins []string) *Hub {
+func NewHub(log *logger.Log, allowedOrigins []string, heartbeat Heartbeat) *Hub {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	// IDs start from the clock so that the ones issued before a restart are
+	// never mistaken for new ones
+	start := uint64(time.Now().UnixMicro())
+
 	return &Hub{
 		clients:    make(map[*Client]bool),
 		Broadcast:  make(chan Message, 256),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
+		resume:     make(chan resumeRequest),
+		replies:    make(chan reply),
+		subscribe:  make(chan subscription),
+		topics:     make(map[string]map[*Client]bool),
+		heartbeat:  heartbeat.withDefaults(),
 		logger:     log,
 		ctx:        ctx,
 		cancel:     cancel,
+		seq:        start,
+		processed:  start,
+		history:    newHistory(ReplayBufferSize),
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				// Allow all origins if none specified (development)
@@ -83,6 +192,8 @@ func NewHub(log *logger.Log, allowedOrigins []string) *Hub {
 
 // Start runs the hub
 func (h *Hub) Start(ctx context.Context) {
+	reap := time.NewTicker(h.heartbeat.PingInterval)
+	defer reap.Stop()
 
 	// Run the main loop
 	for {
@@ -98,6 +209,24 @@ func (h *Hub) Start(ctx context.Context) {
 			h.registerClient(client)
 		case client := <-h.Unregister:
 			h.unregisterClient(client)
+		case r := <-h.resume:
+			h.mu.RLock()
+			_, ok := h.clients[r.client]
+			h.mu.RUnlock()
+			if ok {
+				h.replay(r.client, r.after)
+			}
+		case r := <-h.replies:
+			h.mu.RLock()
+			_, ok := h.clients[r.client]
+			h.mu.RUnlock()
+			if ok {
+				h.send(r.client, r.message)
+			}
+		case s := <-h.subscribe:
+			h.applySubscription(s)
+		case <-reap.C:
+			h.reapIdle()
 		case message := <-h.Broadcast:
 			h.broadcastMessage(message)
 		}
@@ -105,8 +234,16 @@ func (h *Hub) Start(ctx context.Context) {
 }
 
 func (h *Hub) registerClient(client *Client) {
+	client.joined = h.processed
+
 	h.mu.Lock()
 	h.clients[client] = true
+	if client.Scope != "" {
+		h.addTopic(client, TopicEvent+client.Scope)
+	}
+	for _, topic := range client.Topics {
+		h.addTopic(client, topic)
+	}
 	clientCount := len(h.clients)
 	h.mu.Unlock()
 
@@ -117,23 +254,74 @@ func (h *Hub) registerClient(client *Client) {
 	case client.Send <- Message{
 		Type: "connected",
 		Data: map[string]interface{}{
-			"client_id": client.ID,
-			"message":   "WebSocket connection established",
+			"client_id":     client.ID,
+			"message":       "WebSocket connection established",
+			"last_event_id": strconv.FormatUint(h.processed, 10),
 		},
 	}:
 	default:
-		h.mu.Lock()
-		delete(h.clients, client)
-		h.mu.Unlock()
-		close(client.Send)
+		h.drop(client)
+		return
+	}
+
+	if client.Snapshot != nil && client.LastEventID != nil {
+		snapshot := Message{
+			Type:    MessageTypeSnapshot,
+			Data:    client.Snapshot,
+			EventID: strconv.FormatUint(*client.LastEventID, 10),
+		}
+		if !h.send(client, snapshot) {
+			return
+		}
+	}
+
+	if client.LastEventID != nil {
+		h.replay(client, *client.LastEventID)
+	}
+}
+
+// replay sends the client the messages broadcast after the given ID and
+// before it connected, or a resync message when they are no longer all
+// buffered. Called from the hub goroutine, no live message can slip in
+// between.
+func (h *Hub) replay(client *Client, after uint64) {
+	// Messages queued before the resume point but not broadcast yet are
+	// skipped when they come through
+	if after > client.after {
+		client.after = after
+	}
+
+	var missed []Message
+	ok := after <= h.LastEventID()
+	if ok {
+		missed, ok = h.history.between(after, client.joined)
+	}
+
+	if !ok {
+		h.logger.Infof("Client %s asked to resume after %d, too far behind", client.ID, after)
+		h.send(client, Message{
+			Type: MessageTypeResync,
+			Data: map[string]interface{}{
+				"last_event_id": strconv.FormatUint(h.processed, 10),
+			},
+		})
+		return
+	}
+
+	h.logger.Infof("Replaying %d messages to client %s", len(missed), client.ID)
+	for _, m := range missed {
+		if m, ok := client.filter(m); ok {
+			if !h.send(client, m) {
+				return
+			}
+		}
 	}
 }
 
 func (h *Hub) unregisterClient(client *Client) {
 	h.mu.Lock()
 	if _, ok := h.clients[client]; ok {
-		delete(h.clients, client)
-		close(client.Send)
+		h.removeClient(client)
 		clientCount := len(h.clients)
 		h.mu.Unlock()
 		h.logger.Infof("Client %s disconnected. Total clients: %d", client.ID, clientCount)
@@ -143,34 +331,141 @@ func (h *Hub) unregisterClient(client *Client) {
 }
 
 func (h *Hub) broadcastMessage(message Message) {
-	h.mu.RLock()
-	clientCount := len(h.clients)
-	clientsCopy := make([]*Client, 0, clientCount)
-	for client := range h.clients {
-		clientsCopy = append(clientsCopy, client)
+	// Messages sent straight to the Broadcast channel have no ID yet
+	if message.seq == 0 {
+		h.seqMu.Lock()
+		h.number(&message)
+		h.seqMu.Unlock()
 	}
+	h.processed = message.seq
+	h.history.push(message)
+
+	h.mu.RLock()
+	clientsCopy := h.recipients(message)
 	h.mu.RUnlock()
 
-	h.logger.Infof("Broadcasting message type '%s' to %d clients", message.Type, clientCount)
+	h.logger.Infof("Broadcasting message type '%s' to %d clients", message.Type, len(clientsCopy))
 
 	for _, client := range clientsCopy {
-		select {
-		case client.Send <- message:
-			// Message sent successfully
-		default:
-			// Client's send channel is full, close it
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.Send)
-			}
-			h.mu.Unlock()
+		if m, ok := client.filter(message); ok {
+			h.send(client, m)
+		}
+	}
+}
+
+// queue numbers a message and queues it for broadcast, dropping it when
+// the broadcast channel is full
+func (h *Hub) queue(message Message) bool {
+	h.seqMu.Lock()
+	defer h.seqMu.Unlock()
+
+	h.number(&message)
+	select {
+	case h.Broadcast <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// number assigns the next ID to a message. It must be called with seqMu
+// held.
+func (h *Hub) number(message *Message) {
+	h.seq++
+	message.seq = h.seq
+	message.EventID = strconv.FormatUint(h.seq, 10)
+}
+
+// LastEventID returns the ID of the last message queued for broadcast. A
+// state read while no change can be broadcast, e.g. under the lock its
+// publisher holds, is up to date with the messages until that ID.
+func (h *Hub) LastEventID() uint64 {
+	h.seqMu.Lock()
+	defer h.seqMu.Unlock()
+	return h.seq
+}
+
+// send queues a message for the client, dropping the client when its send
+// channel is full
+func (h *Hub) send(client *Client, m Message) bool {
+	select {
+	case client.Send <- m:
+		// Message sent successfully
+		return true
+	default:
+		// Client's send channel is full, close it
+		h.drop(client)
+		return false
+	}
+}
+
+func (h *Hub) drop(client *Client) {
+	h.mu.Lock()
+	if _, ok := h.clients[client]; ok {
+		h.removeClient(client)
+		h.counters.dropped.Add(1)
+	}
+	h.mu.Unlock()
+}
+
+// removeClient must be called with the hub locked
+func (h *Hub) removeClient(client *Client) {
+	delete(h.clients, client)
+	for topic := range client.topics {
+		h.removeTopic(client, topic)
+	}
+	close(client.Send)
+}
+
+// filter returns the message as the client should get it, false when the
+// client does not follow its topics or nothing is left once the flagged
+// waypoints are excluded
+func (c *Client) filter(message Message) (Message, bool) {
+	if message.seq <= c.after {
+		return Message{}, false
+	}
+	if !c.follows(message) {
+		return Message{}, false
+	}
+
+	if c.ExcludeFlagged && message.unflagged != nil {
+		if message.unflagged.Type == "" {
+			return Message{}, false
 		}
+		m := *message.unflagged
+		m.EventID = message.EventID
+		return m, true
 	}
+	return message, true
 }
 
-// BroadcastWaypoints broadcasts new waypoints to all connected clients
+// BroadcastWaypoints broadcasts new waypoints to the clients following
+// their event or device
 func (h *Hub) BroadcastWaypoints(waypoints []*waypoint.WaypointDTO) {
+	message := waypointMessage(waypoints)
+
+	good := make([]*waypoint.WaypointDTO, 0, len(waypoints))
+	for _, w := range waypoints {
+		if w.QualityFlag == "" {
+			good = append(good, w)
+		}
+	}
+	if len(good) < len(waypoints) {
+		message.unflagged = &Message{}
+		if len(good) > 0 {
+			unflagged := waypointMessage(good)
+			message.unflagged = &unflagged
+		}
+	}
+
+	if h.queue(message) {
+		h.logger.Infof("Waypoint broadcast message queued for %d waypoints", len(waypoints))
+	} else {
+		h.logger.Warn("Broadcast channel is full, dropping message")
+	}
+}
+
+func waypointMessage(waypoints []*waypoint.WaypointDTO) Message {
 	message := Message{
 		Type: MessageTypeWaypoint,
 		Data: map[string]interface{}{
@@ -179,14 +474,80 @@ func (h *Hub) BroadcastWaypoints(waypoints []*waypoint.WaypointDTO) {
 		},
 	}
 
-	select {
-	case h.Broadcast <- message:
-		h.logger.Infof("Waypoint broadcast message queued for %d waypoints", len(waypoints))
-	default:
+	// Waypoints registered together always belong to the same event and
+	// come from the same device
+	if len(waypoints) > 0 {
+		message.topics = topicsOf(waypoints[0].EventID, waypoints[0].DeviceID)
+	}
+	return message
+}
+
+// BroadcastPosition broadcasts the smoothed position of a tracker to the
+// clients following its event or device. It is computed from good fixes
+// only, so clients excluding the flagged ones get it too.
+func (h *Hub) BroadcastPosition(p *waypoint.PositionDTO) {
+	message := Message{
+		Type: MessageTypePosition,
+		Data: map[string]interface{}{
+			"position": p,
+		},
+		topics: topicsOf(p.EventID, p.DeviceID),
+	}
+
+	if h.queue(message) {
+		h.logger.Infof("Position message queued for device %s", p.DeviceID)
+	} else {
+		h.logger.Warn("Broadcast channel is full, dropping message")
+	}
+}
+
+// BroadcastStop broadcasts a stop transition to the clients following its
+// event
+func (h *Hub) BroadcastStop(messageType string, s *stop.StopDTO) {
+	message := Message{
+		Type: messageType,
+		Data: map[string]interface{}{
+			"stop": s,
+		},
+		topics: []string{EventTopic(s.EventID)},
+	}
+
+	if h.queue(message) {
+		h.logger.Infof("Stop %s message queued for stop %s", messageType, s.Letter)
+	} else {
+		h.logger.Warn("Broadcast channel is full, dropping message")
+	}
+}
+
+// Publish broadcasts a message to the clients subscribed to a topic, see
+// EventTopic and DeviceTopic
+func (h *Hub) Publish(topic, messageType string, data interface{}) {
+	message := Message{
+		Type:   messageType,
+		Data:   data,
+		topics: []string{topic},
+	}
+
+	if h.queue(message) {
+		h.logger.Infof("%s message queued for topic %s", messageType, topic)
+	} else {
 		h.logger.Warn("Broadcast channel is full, dropping message")
 	}
 }
 
+// topicsOf returns the topics of a message about a device, within an event
+// when eventID is set
+func topicsOf(eventID *uuid.UUID, deviceID string) []string {
+	var topics []string
+	if eventID != nil {
+		topics = append(topics, EventTopic(*eventID))
+	}
+	if deviceID != "" {
+		topics = append(topics, DeviceTopic(deviceID))
+	}
+	return topics
+}
+
 // GetClientCount returns the number of connected clients
 func (h *Hub) GetClientCount() int {
 	h.mu.RLock()
@@ -201,15 +562,22 @@ func (h *Hub) Upgrade(w http.ResponseWriter, r *http.Request, clientID string) (
 		return nil, err
 	}
 
+	return h.NewClient(clientID, conn), nil
+}
+
+// NewClient returns a client to register with the hub. conn is nil for the
+// transports other than WebSocket, the caller then drains Send itself.
+func (h *Hub) NewClient(clientID string, conn *websocket.Conn) *Client {
+	// The send buffer has room for a full replay on top of the live traffic
 	client := &Client{
 		ID:     clientID,
 		Conn:   conn,
-		Send:   make(chan Message, 256),
+		Send:   make(chan Message, ReplayBufferSize+256),
 		Hub:    h,
 		Logger: h.logger,
 	}
-
-	return client, nil
+	client.Seen()
+	return client
 }
 
 // Stop gracefully stops the hub
@@ -223,12 +591,24 @@ func (h *Hub) shutdown() {
 	h.mu.Lock()
 	for client := range h.clients {
 		close(client.Send)
-		client.Conn.Close()
+		if client.Conn != nil {
+			client.Conn.Close()
+		}
 	}
 	h.clients = make(map[*Client]bool)
+	h.topics = make(map[string]map[*Client]bool)
 	h.mu.Unlock()
 }
 
+// Close unregisters the client, for the transports that do not run
+// ReadPump. The hub then closes Send.
+func (c *Client) Close() {
+	select {
+	case c.Hub.Unregister <- c:
+	case <-c.Hub.ctx.Done():
+	}
+}
+
 // ReadPump handles reading from the WebSocket connection
 func (c *Client) ReadPump() {
 	defer func() {
@@ -236,37 +616,95 @@ func (c *Client) ReadPump() {
 		c.Conn.Close()
 	}()
 
-	// Set read limits and timeouts
+	// Set read limits and timeouts, any message or pong from the client
+	// extends the deadline
+	pongWait := c.Hub.heartbeat.PongWait
 	c.Conn.SetReadLimit(512)
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		c.Hub.counters.pongsReceived.Add(1)
+		c.Seen()
+		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
 
 	for {
 		var msg Message
 		err := c.Conn.ReadJSON(&msg)
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				c.Hub.counters.timedOut.Add(1)
+				c.Logger.Infof("WebSocket client %s timed out", c.ID)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				c.Logger.Errorf("WebSocket read error for client %s: %v", c.ID, err)
 			}
 			break
 		}
+		c.Seen()
+		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 
-		// Handle ping messages
-		if msg.Type == MessageTypePing {
+		switch msg.Type {
+		case MessageTypePing:
+			if !c.reply(Message{Type: MessageTypePong}) {
+				return
+			}
+		case MessageTypeResume:
+			// Replays what was missed before this connection, live
+			// messages already received on it are not sent again
+			after, err := strconv.ParseUint(msg.EventID, 10, 64)
+			if err != nil {
+				if !c.reply(Message{Type: MessageTypeError, Error: "resume needs the event_id of the last message received"}) {
+					return
+				}
+				continue
+			}
+			select {
+			case c.Hub.resume <- resumeRequest{client: c, after: after}:
+			case <-c.Hub.ctx.Done():
+				return
+			}
+		case MessageTypeSubscribe, MessageTypeUnsubscribe:
+			s := subscription{client: c, subscribe: msg.Type == MessageTypeSubscribe}
+			if topic, ok := ParseTopic(msg.Topic); ok {
+				s.topic = topic
+			} else {
+				s.topic = msg.Topic
+				s.err = errInvalidTopic
+			}
 			select {
-			case c.Send <- Message{Type: MessageTypePong}:
-			default:
+			case c.Hub.subscribe <- s:
+			case <-c.Hub.ctx.Done():
 				return
 			}
 		}
 	}
 }
 
-// WritePump handles writing to the WebSocket connection
+// reply sends a message to the client through the hub, false once the hub
+// stopped
+func (c *Client) reply(message Message) bool {
+	select {
+	case c.Hub.replies <- reply{client: c, message: message}:
+		return true
+	case <-c.Hub.ctx.Done():
+		return false
+	}
+}
+
+// WritePump handles writing to the WebSocket connection and pings the
+// client every PingInterval
 func (c *Client) WritePump() {
-	defer c.Conn.Close()
+	heartbeat := c.Hub.heartbeat
+	ticker := time.NewTicker(heartbeat.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
 
 	for {
 		select {
 		case message, ok := <-c.Send:
+			c.Conn.SetWriteDeadline(time.Now().Add(heartbeat.WriteWait))
 			if !ok {
 				// The hub closed the channel
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
@@ -274,9 +712,18 @@ func (c *Client) WritePump() {
 			}
 
 			if err := c.Conn.WriteJSON(message); err != nil {
+				c.Hub.counters.writeErrors.Add(1)
 				c.Logger.Errorf("WebSocket write error for client %s: %v", c.ID, err)
 				return
 			}
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(heartbeat.WriteWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.Hub.counters.writeErrors.Add(1)
+				c.Logger.Errorf("WebSocket ping error for client %s: %v", c.ID, err)
+				return
+			}
+			c.Hub.counters.pingsSent.Add(1)
 		}
 	}
 }
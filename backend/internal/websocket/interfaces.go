@@ -1,9 +1,17 @@
 package websocket
 
-import "github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+import (
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/stop"
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
+)
 
-// Broadcaster interface for broadcasting waypoints
+// Broadcaster interface for broadcasting waypoints, smoothed positions and
+// stop transitions, and for publishing any message to a topic
 type Broadcaster interface {
 	BroadcastWaypoints(waypoints []*waypoint.WaypointDTO)
+	BroadcastPosition(p *waypoint.PositionDTO)
+	BroadcastStop(messageType string, s *stop.StopDTO)
+	Publish(topic, messageType string, data interface{})
 	GetClientCount() int
+	LastEventID() uint64
 }
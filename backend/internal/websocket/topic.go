@@ -0,0 +1,183 @@
+package websocket
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Topic prefixes, a topic is the prefix followed by the event ID or the
+// device serial number
+const (
+	TopicEvent  = "event:"
+	TopicDevice = "device:"
+)
+
+// Subscription messages sent by the clients and their acknowledgements
+const (
+	MessageTypeSubscribe    = "subscribe"
+	MessageTypeUnsubscribe  = "unsubscribe"
+	MessageTypeSubscribed   = "subscribed"
+	MessageTypeUnsubscribed = "unsubscribed"
+)
+
+// maxTopicLength bounds the topics a client may subscribe to
+const maxTopicLength = 128
+
+// MaxClientTopics caps the subscriptions of a client
+const MaxClientTopics = 64
+
+// Errors sent back to the clients for the subscriptions refused
+const (
+	errInvalidTopic  = "topic must be event:<event id> or device:<serial number>"
+	errTooManyTopics = "too many subscriptions"
+)
+
+// EventTopic is the topic of the messages about an event
+func EventTopic(id uuid.UUID) string {
+	return TopicEvent + id.String()
+}
+
+// DeviceTopic is the topic of the messages about a tracker
+func DeviceTopic(serial string) string {
+	return TopicDevice + serial
+}
+
+// ParseTopic validates a topic sent by a client and returns it in its
+// canonical form
+func ParseTopic(topic string) (string, bool) {
+	if len(topic) > maxTopicLength {
+		return "", false
+	}
+
+	switch {
+	case strings.HasPrefix(topic, TopicEvent):
+		id, err := uuid.Parse(strings.TrimPrefix(topic, TopicEvent))
+		if err != nil {
+			return "", false
+		}
+		return EventTopic(id), true
+	case strings.HasPrefix(topic, TopicDevice):
+		if strings.TrimPrefix(topic, TopicDevice) == "" {
+			return "", false
+		}
+		return topic, true
+	default:
+		return "", false
+	}
+}
+
+// subscription asks the hub to add or remove a client from a topic. err is
+// set when the request was invalid, the hub only reports it to the client
+// since it owns its Send channel.
+type subscription struct {
+	client    *Client
+	topic     string
+	subscribe bool
+	err       string
+}
+
+// applySubscription updates the topic sets and acknowledges the change to
+// the client. Called from the hub goroutine, the messages broadcast after
+// the acknowledgement follow the new subscriptions.
+func (h *Hub) applySubscription(s subscription) {
+	h.mu.Lock()
+	if _, ok := h.clients[s.client]; !ok {
+		h.mu.Unlock()
+		return
+	}
+	if s.err == "" && s.subscribe && !s.client.topics[s.topic] && len(s.client.topics) >= MaxClientTopics {
+		s.err = errTooManyTopics
+	}
+	if s.err == "" {
+		if s.subscribe {
+			h.addTopic(s.client, s.topic)
+		} else {
+			h.removeTopic(s.client, s.topic)
+		}
+	}
+	h.mu.Unlock()
+
+	if s.err != "" {
+		h.send(s.client, Message{Type: MessageTypeError, Error: s.err, Topic: s.topic})
+		return
+	}
+
+	messageType := MessageTypeSubscribed
+	if !s.subscribe {
+		messageType = MessageTypeUnsubscribed
+	}
+	h.send(s.client, Message{Type: messageType, Topic: s.topic})
+}
+
+// addTopic must be called with the hub locked. Once a client subscribed
+// it only gets the messages of its topics, even after unsubscribing from
+// all of them.
+func (h *Hub) addTopic(client *Client, topic string) {
+	if client.topics == nil {
+		client.topics = make(map[string]bool)
+	}
+	client.topics[topic] = true
+
+	clients, ok := h.topics[topic]
+	if !ok {
+		clients = make(map[*Client]bool)
+		h.topics[topic] = clients
+	}
+	clients[client] = true
+}
+
+// removeTopic must be called with the hub locked
+func (h *Hub) removeTopic(client *Client, topic string) {
+	delete(client.topics, topic)
+
+	if clients, ok := h.topics[topic]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// recipients returns the clients following any of the topics of the
+// message, along with the ones that never subscribed and get everything.
+// It must be called with the hub locked.
+func (h *Hub) recipients(message Message) []*Client {
+	res := make([]*Client, 0, len(h.clients))
+	if len(message.topics) == 0 {
+		for client := range h.clients {
+			res = append(res, client)
+		}
+		return res
+	}
+
+	for client := range h.clients {
+		if client.topics == nil {
+			res = append(res, client)
+		}
+	}
+	seen := make(map[*Client]bool)
+	for _, topic := range message.topics {
+		for client := range h.topics[topic] {
+			if !seen[client] {
+				seen[client] = true
+				res = append(res, client)
+			}
+		}
+	}
+	return res
+}
+
+// follows reports whether the client gets the message given its
+// subscriptions, the same way as recipients
+func (c *Client) follows(message Message) bool {
+	if len(message.topics) == 0 || c.topics == nil {
+		return true
+	}
+	for _, topic := range message.topics {
+		if c.topics[topic] {
+			return true
+		}
+	}
+	return false
+}
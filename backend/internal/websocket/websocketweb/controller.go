@@ -1,8 +1,11 @@
 package websocketweb
 
 import (
+	"context"
 	"net/http"
+	"strconv"
 
+	"github.com/antoniosarro/saint-tracker/backend/internal/domain/waypoint"
 	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
 	"github.com/antoniosarro/saint-tracker/backend/internal/websocket"
 	"github.com/antoniosarro/saint-tracker/backend/pkg/logger"
@@ -10,15 +13,22 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// iSnapshotUseCase provides the live state sent on connect
+type iSnapshotUseCase interface {
+	Snapshot(ctx context.Context, eventID *uuid.UUID) (*waypoint.SnapshotDTO, error)
+}
+
 type controller struct {
-	hub *websocket.Hub
-	log *logger.Log
+	hub       *websocket.Hub
+	snapshots iSnapshotUseCase
+	log       *logger.Log
 }
 
-func newController(hub *websocket.Hub, log *logger.Log) *controller {
+func newController(hub *websocket.Hub, snapshots iSnapshotUseCase, log *logger.Log) *controller {
 	return &controller{
-		hub: hub,
-		log: log,
+		hub:       hub,
+		snapshots: snapshots,
+		log:       log,
 	}
 }
 
@@ -27,12 +37,18 @@ func (c *controller) handleWebSocket(ctx echo.Context) error {
 	// Generate unique client ID
 	clientID := uuid.New().String()
 
+	opts, err := c.parseClientOptions(ctx, ctx.QueryParam("last_event_id"))
+	if err != nil {
+		return err
+	}
+
 	// Upgrade connection
 	client, err := c.hub.Upgrade(ctx.Response(), ctx.Request(), clientID)
 	if err != nil {
 		c.log.Errorf("Failed to upgrade connection: %v", err)
 		return httperrors.New(httperrors.Internal, "Failed to establish WebSocket connection")
 	}
+	opts.apply(client)
 
 	// Register client
 	c.hub.Register <- client
@@ -44,11 +60,107 @@ func (c *controller) handleWebSocket(ctx echo.Context) error {
 	return nil
 }
 
-// getStats returns WebSocket connection statistics
+// clientOptions are the query parameters shared by the WebSocket and the
+// SSE endpoints
+type clientOptions struct {
+	scope          string
+	topics         []string
+	excludeFlagged bool
+	lastEventID    *uint64
+	snapshot       *waypoint.SnapshotDTO
+}
+
+// parseClientOptions reads event_id, topic, exclude_flagged and snapshot
+// from the query, lastEventID being the resume point sent by the client
+// if any. The snapshot is taken here, before the connection is registered.
+func (c *controller) parseClientOptions(ctx echo.Context, lastEventID string) (*clientOptions, error) {
+	opts := new(clientOptions)
+
+	// Optionally restrict the connection to a single event
+	var eventID *uuid.UUID
+	if param := ctx.QueryParam("event_id"); param != "" {
+		id, err := uuid.Parse(param)
+		if err != nil {
+			return nil, httperrors.New(httperrors.InvalidArgument, "Invalid event_id")
+		}
+		eventID = &id
+		opts.scope = id.String()
+	}
+
+	// Optionally subscribe to topics right away, e.g. for the clients
+	// that cannot send subscribe messages
+	for _, param := range ctx.QueryParams()["topic"] {
+		topic, ok := websocket.ParseTopic(param)
+		if !ok {
+			return nil, httperrors.New(httperrors.InvalidArgument, "topic must be event:<event id> or device:<serial number>")
+		}
+		opts.topics = append(opts.topics, topic)
+	}
+	if len(opts.topics) > websocket.MaxClientTopics {
+		return nil, httperrors.New(httperrors.InvalidArgument, "Too many topics")
+	}
+
+	// Optionally leave out the waypoints flagged as bad fixes
+	if param := ctx.QueryParam("exclude_flagged"); param != "" {
+		exclude, err := strconv.ParseBool(param)
+		if err != nil {
+			return nil, httperrors.New(httperrors.InvalidArgument, "exclude_flagged must be true or false")
+		}
+		opts.excludeFlagged = exclude
+	}
+
+	// Optionally resume after the last message received before a
+	// reconnection, the missed ones are replayed first
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return nil, httperrors.New(httperrors.InvalidArgument, "Invalid last_event_id")
+		}
+		opts.lastEventID = &id
+	}
+
+	// Optionally start with the live state of the event. The messages
+	// broadcast since it was taken are replayed after it, a last_event_id
+	// is then ignored.
+	if param := ctx.QueryParam("snapshot"); param != "" {
+		withSnapshot, err := strconv.ParseBool(param)
+		if err != nil {
+			return nil, httperrors.New(httperrors.InvalidArgument, "snapshot must be true or false")
+		}
+		if withSnapshot {
+			if opts.snapshot, err = c.snapshots.Snapshot(ctx.Request().Context(), eventID); err != nil {
+				return nil, err
+			}
+			opts.lastEventID = &opts.snapshot.LastEventID
+		}
+	}
+
+	return opts, nil
+}
+
+func (o *clientOptions) apply(client *websocket.Client) {
+	client.Scope = o.scope
+	client.Topics = o.topics
+	client.ExcludeFlagged = o.excludeFlagged
+	client.LastEventID = o.lastEventID
+	if o.snapshot != nil {
+		client.Snapshot = o.snapshot
+	}
+}
+
+// getStats returns WebSocket connection statistics, the counters run since
+// the server started
 func (c *controller) getStats(ctx echo.Context) error {
+	hubStats := c.hub.Stats()
 	stats := map[string]interface{}{
-		"connected_clients": c.hub.GetClientCount(),
+		"connected_clients": hubStats.Clients,
 		"status":            "active",
+		"pings_sent":        hubStats.PingsSent,
+		"pongs_received":    hubStats.PongsReceived,
+		"timed_out":         hubStats.TimedOut,
+		"write_errors":      hubStats.WriteErrors,
+		"reaped":            hubStats.Reaped,
+		"dropped":           hubStats.Dropped,
 	}
 
 	return ctx.JSON(http.StatusOK, stats)
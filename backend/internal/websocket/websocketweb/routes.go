@@ -7,14 +7,17 @@ import (
 )
 
 type Options struct {
-	Log *logger.Log
-	Hub *websocket.Hub
+	Log             *logger.Log
+	Hub             *websocket.Hub
+	SnapshotUseCase iSnapshotUseCase
 }
 
 func Route(web *web.Web, opts *Options) {
-	con := newController(opts.Hub, opts.Log)
+	con := newController(opts.Hub, opts.SnapshotUseCase, opts.Log)
 
 	g := web.Echo.Group("/api/v1/ws")
 	g.GET("/connect", con.handleWebSocket)
 	g.GET("/stats", con.getStats)
+
+	web.Echo.GET("/api/v1/stream", con.handleStream)
 }
@@ -0,0 +1,99 @@
+package websocketweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/antoniosarro/saint-tracker/backend/internal/sdk/httperrors"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// handleStream sends the hub messages as Server-Sent Events, for the
+// viewers that cannot use a WebSocket. Each event is named after the
+// message type and carries the same JSON as the WebSocket, with the
+// message ID as event ID so that the browser resumes with Last-Event-ID.
+func (c *controller) handleStream(ctx echo.Context) error {
+	lastEventID := ctx.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = ctx.QueryParam("last_event_id")
+	}
+
+	opts, err := c.parseClientOptions(ctx, lastEventID)
+	if err != nil {
+		return err
+	}
+
+	res := ctx.Response()
+	if _, ok := res.Writer.(http.Flusher); !ok {
+		return httperrors.New(httperrors.Internal, "Streaming is not supported")
+	}
+	rc := http.NewResponseController(res)
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	client := c.hub.NewClient(uuid.New().String(), nil)
+	opts.apply(client)
+	c.hub.Register <- client
+	defer client.Close()
+
+	// A comment is written to idle streams every ping interval, so that
+	// proxies keep them open and the hub sees the client as active
+	conf := c.hub.Heartbeat()
+	heartbeat := time.NewTicker(conf.PingInterval)
+	defer heartbeat.Stop()
+
+	// write sends a chunk within the write timeout, a viewer that stopped
+	// reading is disconnected
+	write := func(chunk string) bool {
+		rc.SetWriteDeadline(time.Now().Add(conf.WriteWait))
+		if _, err := fmt.Fprint(res, chunk); err != nil {
+			c.hub.WriteFailed()
+			c.log.Errorf("SSE write error for client %s: %v", client.ID, err)
+			return false
+		}
+		if err := rc.Flush(); err != nil {
+			c.hub.WriteFailed()
+			c.log.Errorf("SSE write error for client %s: %v", client.ID, err)
+			return false
+		}
+		client.Seen()
+		return true
+	}
+
+	done := ctx.Request().Context().Done()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-heartbeat.C:
+			if !write(": ping\n\n") {
+				return nil
+			}
+		case message, ok := <-client.Send:
+			if !ok {
+				// The hub closed the channel
+				return nil
+			}
+
+			data, err := json.Marshal(message)
+			if err != nil {
+				c.log.Errorf("SSE encoding error for client %s: %v", client.ID, err)
+				continue
+			}
+			chunk := fmt.Sprintf("event: %s\ndata: %s\n\n", message.Type, data)
+			if message.EventID != "" {
+				chunk = "id: " + message.EventID + "\n" + chunk
+			}
+			if !write(chunk) {
+				return nil
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"embed"
+	"errors"
 	"fmt"
 
 	"github.com/antoniosarro/saint-tracker/backend/config"
@@ -10,7 +11,7 @@ import (
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jmoiron/sqlx"
 
-	_ "github.com/mattn/go-sqlite3"
+	sqlite3driver "github.com/mattn/go-sqlite3"
 )
 
 //go:embed migrations/*.sql
@@ -69,3 +70,14 @@ func runMigrations(db *sqlx.DB) error {
 
 	return nil
 }
+
+// IsUniqueViolation reports whether err was caused by a UNIQUE or PRIMARY KEY
+// constraint
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3driver.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3driver.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3driver.ErrConstraintPrimaryKey
+	}
+	return false
+}
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_waypoint_event;
+
+ALTER TABLE waypoint DROP COLUMN event_id;
+
+DROP INDEX IF EXISTS idx_event_scheduled_start;
+DROP INDEX IF EXISTS idx_event_status;
+
+DROP TABLE IF EXISTS event;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS event (
+    id TEXT PRIMARY KEY,
+    name VARCHAR(150) NOT NULL,
+    saint VARCHAR(100) NOT NULL,
+    town VARCHAR(100) NOT NULL DEFAULT '',
+    scheduled_start DATETIME NOT NULL,
+    scheduled_end DATETIME NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'scheduled',
+    started_at DATETIME,
+    ended_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_status ON event(status);
+CREATE INDEX IF NOT EXISTS idx_event_scheduled_start ON event(scheduled_start);
+
+ALTER TABLE waypoint ADD COLUMN event_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_waypoint_event ON waypoint(event_id, created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE esp32_devices DROP COLUMN previous_token_expires_at;
+ALTER TABLE esp32_devices DROP COLUMN previous_token;
+
+CREATE INDEX IF NOT EXISTS idx_esp32_token ON esp32_devices(token);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_esp32_token;
+
+ALTER TABLE esp32_devices ADD COLUMN previous_token VARCHAR(128);
+ALTER TABLE esp32_devices ADD COLUMN previous_token_expires_at DATETIME;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_operator_username;
+
+DROP TABLE IF EXISTS operator;
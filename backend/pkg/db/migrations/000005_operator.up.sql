@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS operator (
+    id TEXT PRIMARY KEY,
+    username VARCHAR(64) NOT NULL UNIQUE,
+    password_hash VARCHAR(128) NOT NULL,
+    role VARCHAR(16) NOT NULL DEFAULT 'viewer',
+    is_active BOOLEAN NOT NULL DEFAULT 1,
+    last_login DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_operator_username ON operator(username);
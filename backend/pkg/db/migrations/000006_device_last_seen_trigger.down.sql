@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS update_esp32_timestamp;
+
+CREATE TRIGGER IF NOT EXISTS update_esp32_timestamp
+    AFTER UPDATE ON esp32_devices
+    FOR EACH ROW
+BEGIN
+    UPDATE esp32_devices SET update_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
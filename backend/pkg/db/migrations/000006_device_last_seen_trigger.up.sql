@@ -0,0 +1,9 @@
+-- last_seen is written in batches by the server, it must not bump update_at
+DROP TRIGGER IF EXISTS update_esp32_timestamp;
+
+CREATE TRIGGER IF NOT EXISTS update_esp32_timestamp
+    AFTER UPDATE OF serial_number, token, previous_token, previous_token_expires_at, device_name, is_active, notes ON esp32_devices
+    FOR EACH ROW
+BEGIN
+    UPDATE esp32_devices SET update_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_stop_event_order;
+
+DROP TABLE IF EXISTS stop;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS stop (
+    id TEXT PRIMARY KEY,
+    event_id TEXT NOT NULL REFERENCES event(id) ON DELETE CASCADE,
+    letter VARCHAR(8) NOT NULL,
+    name VARCHAR(150) NOT NULL,
+    latitude REAL NOT NULL,
+    longitude REAL NOT NULL,
+    radius REAL NOT NULL DEFAULT 0,
+    visit_order INTEGER NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    arrived_at DATETIME,
+    departed_at DATETIME,
+    duration INTEGER NOT NULL DEFAULT 0,
+    visit_seq INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stop_event_order ON stop(event_id, visit_order);
@@ -0,0 +1,2 @@
+ALTER TABLE esp32_devices DROP COLUMN previous_frame_key;
+ALTER TABLE esp32_devices DROP COLUMN frame_key;
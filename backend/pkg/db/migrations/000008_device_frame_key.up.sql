@@ -0,0 +1,2 @@
+ALTER TABLE esp32_devices ADD COLUMN frame_key VARCHAR(64);
+ALTER TABLE esp32_devices ADD COLUMN previous_frame_key VARCHAR(64);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_waypoint_device_time;
+DROP INDEX IF EXISTS idx_waypoint_device_client;
+
+ALTER TABLE waypoint DROP COLUMN client_id;
+ALTER TABLE waypoint DROP COLUMN device_id;
@@ -0,0 +1,7 @@
+ALTER TABLE waypoint ADD COLUMN device_id VARCHAR(64);
+ALTER TABLE waypoint ADD COLUMN client_id VARCHAR(64);
+
+-- A point resent by a tracker is recognised by the id the tracker gave it,
+-- or by its timestamp when it has none
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waypoint_device_client ON waypoint(device_id, client_id) WHERE client_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waypoint_device_time ON waypoint(device_id, created_at) WHERE client_id IS NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE waypoint DROP COLUMN accuracy;
+ALTER TABLE waypoint DROP COLUMN satellites;
+ALTER TABLE waypoint DROP COLUMN hdop;
+ALTER TABLE waypoint DROP COLUMN heading;
+ALTER TABLE waypoint DROP COLUMN altitude;
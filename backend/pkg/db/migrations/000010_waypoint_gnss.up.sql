@@ -0,0 +1,5 @@
+ALTER TABLE waypoint ADD COLUMN altitude REAL;
+ALTER TABLE waypoint ADD COLUMN heading REAL;
+ALTER TABLE waypoint ADD COLUMN hdop REAL;
+ALTER TABLE waypoint ADD COLUMN satellites INTEGER;
+ALTER TABLE waypoint ADD COLUMN accuracy REAL;
@@ -0,0 +1,4 @@
+ALTER TABLE event DROP COLUMN area_east;
+ALTER TABLE event DROP COLUMN area_north;
+ALTER TABLE event DROP COLUMN area_west;
+ALTER TABLE event DROP COLUMN area_south;
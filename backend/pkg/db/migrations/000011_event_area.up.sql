@@ -0,0 +1,4 @@
+ALTER TABLE event ADD COLUMN area_south REAL;
+ALTER TABLE event ADD COLUMN area_west REAL;
+ALTER TABLE event ADD COLUMN area_north REAL;
+ALTER TABLE event ADD COLUMN area_east REAL;
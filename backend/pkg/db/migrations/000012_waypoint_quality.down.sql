@@ -0,0 +1 @@
+ALTER TABLE waypoint DROP COLUMN quality_flag;
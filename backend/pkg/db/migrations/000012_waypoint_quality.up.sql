@@ -0,0 +1 @@
+ALTER TABLE waypoint ADD COLUMN quality_flag VARCHAR(16);
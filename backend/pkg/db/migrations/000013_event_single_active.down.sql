@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_event_single_active;
@@ -0,0 +1,8 @@
+-- Only one event can be active at a time, the ones left active by a race
+-- before this index are completed, the most recently started one is kept
+UPDATE event SET status = 'completed', ended_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE status = 'active' AND id NOT IN (
+    SELECT id FROM event WHERE status = 'active' ORDER BY started_at DESC LIMIT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_event_single_active ON event(status) WHERE status = 'active';
@@ -0,0 +1,70 @@
+package geo
+
+import (
+	"math"
+	"time"
+)
+
+// EarthRadius is the mean Earth radius in meters
+const EarthRadius = 6371000.0
+
+// Point is a timestamped position in decimal degrees
+type Point struct {
+	Latitude  float64
+	Longitude float64
+	Time      time.Time
+}
+
+// Distance returns the great-circle distance in meters between two points
+// using the Haversine formula
+func Distance(a, b Point) float64 {
+	lat1 := toRadians(a.Latitude)
+	lat2 := toRadians(b.Latitude)
+	dLat := toRadians(b.Latitude - a.Latitude)
+	dLng := toRadians(b.Longitude - a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * EarthRadius * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
+
+// Project maps p to planar meters east and north of the origin with an
+// equirectangular projection, accurate enough at the scale of a town
+func Project(origin, p Point) (float64, float64) {
+	x := toRadians(p.Longitude-origin.Longitude) * math.Cos(toRadians(origin.Latitude)) * EarthRadius
+	y := toRadians(p.Latitude-origin.Latitude) * EarthRadius
+	return x, y
+}
+
+// Unproject is the inverse of Project
+func Unproject(origin Point, x, y float64) Point {
+	return Point{
+		Latitude:  origin.Latitude + toDegrees(y/EarthRadius),
+		Longitude: origin.Longitude + toDegrees(x/(EarthRadius*math.Cos(toRadians(origin.Latitude)))),
+	}
+}
+
+// SegmentDistance returns the distance in meters from p to the segment a-b
+func SegmentDistance(p, a, b Point) float64 {
+	px, py := Project(a, p)
+	bx, by := Project(a, b)
+
+	lenSq := bx*bx + by*by
+	if lenSq == 0 {
+		return math.Hypot(px, py)
+	}
+
+	t := (px*bx + py*by) / lenSq
+	t = math.Max(0, math.Min(1, t))
+
+	return math.Hypot(px-t*bx, py-t*by)
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func toDegrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
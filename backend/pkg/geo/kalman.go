@@ -0,0 +1,178 @@
+package geo
+
+import (
+	"math"
+	"time"
+)
+
+// Default measurement noise of the Kalman filter, as standard deviations
+const (
+	// DefaultFixAccuracy is the position error in meters assumed for a fix
+	// that reports no accuracy
+	DefaultFixAccuracy = 10.0
+	// SpeedAccuracy is the velocity error in m/s assumed for a reported
+	// speed
+	SpeedAccuracy = 0.5
+)
+
+// Fix is a position measurement fed to a Kalman filter. Accuracy is the
+// position error in meters, zero for the default. Speed is in km/h and
+// Heading in degrees clockwise from north, nil when not reported.
+type Fix struct {
+	Point
+	Accuracy float64
+	Speed    *float64
+	Heading  *float64
+}
+
+// Estimate is the smoothed state of a Kalman filter. Speed is in km/h,
+// Heading in degrees clockwise from north and Accuracy is the position
+// error in meters.
+type Estimate struct {
+	Point
+	Speed    float64
+	Heading  float64
+	Accuracy float64
+}
+
+// Kalman smooths a stream of fixes with a constant velocity model. The
+// state is kept in planar meters around the first fix, east and north are
+// filtered independently. Acceleration is the process noise in m/s², the
+// lower it is the more the estimate trusts its own motion over new fixes.
+type Kalman struct {
+	Acceleration float64
+
+	origin Point
+	last   time.Time
+	east   axisFilter
+	north  axisFilter
+	ready  bool
+}
+
+// axisFilter is the position and velocity along one axis with their
+// covariance
+type axisFilter struct {
+	pos, vel float64
+	p        [2][2]float64
+}
+
+// NewKalman returns a filter with the given process noise in m/s²
+func NewKalman(acceleration float64) *Kalman {
+	return &Kalman{Acceleration: acceleration}
+}
+
+// Update feeds a fix to the filter and returns the new estimate. Fixes
+// older than the last one are ignored and false is returned. A fix with a
+// speed but no heading only tells the velocity when the speed is zero,
+// which is what keeps a standing tracker from drifting with the noise.
+func (k *Kalman) Update(f Fix) (Estimate, bool) {
+	accuracy := f.Accuracy
+	if accuracy <= 0 {
+		accuracy = DefaultFixAccuracy
+	}
+	r := accuracy * accuracy
+
+	if !k.ready {
+		k.origin = f.Point
+		k.last = f.Time
+		k.east = newAxisFilter(r)
+		k.north = newAxisFilter(r)
+		k.ready = true
+	} else {
+		if f.Time.Before(k.last) {
+			return k.Estimate(), false
+		}
+		dt := f.Time.Sub(k.last).Seconds()
+		k.last = f.Time
+
+		q := k.Acceleration * k.Acceleration
+		k.east.predict(dt, q)
+		k.north.predict(dt, q)
+
+		x, y := Project(k.origin, f.Point)
+		k.east.updatePosition(x, r)
+		k.north.updatePosition(y, r)
+	}
+
+	if f.Speed != nil {
+		rv := SpeedAccuracy * SpeedAccuracy
+		speed := *f.Speed / 3.6
+		switch {
+		case f.Heading != nil:
+			heading := toRadians(*f.Heading)
+			k.east.updateVelocity(speed*math.Sin(heading), rv)
+			k.north.updateVelocity(speed*math.Cos(heading), rv)
+		case speed == 0:
+			k.east.updateVelocity(0, rv)
+			k.north.updateVelocity(0, rv)
+		}
+	}
+
+	return k.Estimate(), true
+}
+
+// Estimate returns the current state of the filter, the zero Estimate
+// before the first fix
+func (k *Kalman) Estimate() Estimate {
+	if !k.ready {
+		return Estimate{}
+	}
+
+	e := Estimate{
+		Point:    Unproject(k.origin, k.east.pos, k.north.pos),
+		Speed:    math.Hypot(k.east.vel, k.north.vel) * 3.6,
+		Accuracy: math.Sqrt(k.east.p[0][0] + k.north.p[0][0]),
+	}
+	e.Time = k.last
+	if e.Speed > 0 {
+		e.Heading = math.Mod(toDegrees(math.Atan2(k.east.vel, k.north.vel))+360, 360)
+	}
+	return e
+}
+
+// newAxisFilter starts at the origin with the measurement variance r and
+// an unknown velocity
+func newAxisFilter(r float64) axisFilter {
+	return axisFilter{p: [2][2]float64{{r, 0}, {0, 100}}}
+}
+
+// predict moves the state dt seconds ahead, q is the acceleration variance
+func (a *axisFilter) predict(dt, q float64) {
+	a.pos += a.vel * dt
+
+	p := a.p
+	a.p[0][0] = p[0][0] + dt*(p[1][0]+p[0][1]) + dt*dt*p[1][1] + q*dt*dt*dt*dt/4
+	a.p[0][1] = p[0][1] + dt*p[1][1] + q*dt*dt*dt/2
+	a.p[1][0] = p[1][0] + dt*p[1][1] + q*dt*dt*dt/2
+	a.p[1][1] = p[1][1] + q*dt*dt
+}
+
+// updatePosition corrects the state with a measured position of variance r
+func (a *axisFilter) updatePosition(z, r float64) {
+	p := a.p
+	s := p[0][0] + r
+	k0, k1 := p[0][0]/s, p[1][0]/s
+	innovation := z - a.pos
+
+	a.pos += k0 * innovation
+	a.vel += k1 * innovation
+	a.p[0][0] = (1 - k0) * p[0][0]
+	a.p[0][1] = (1 - k0) * p[0][1]
+	a.p[1][0] = p[1][0] - k1*p[0][0]
+	a.p[1][1] = p[1][1] - k1*p[0][1]
+}
+
+// updateVelocity corrects the state with a measured velocity of variance r
+func (a *axisFilter) updateVelocity(z, r float64) {
+	p := a.p
+	s := p[1][1] + r
+	k0, k1 := p[0][1]/s, p[1][1]/s
+	innovation := z - a.vel
+
+	a.pos += k0 * innovation
+	a.vel += k1 * innovation
+	a.p[0][0] = p[0][0] - k0*p[1][0]
+	a.p[0][1] = p[0][1] - k0*p[1][1]
+	a.p[1][0] = (1 - k1) * p[1][0]
+	a.p[1][1] = (1 - k1) * p[1][1]
+}
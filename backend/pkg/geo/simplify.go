@@ -0,0 +1,161 @@
+package geo
+
+import (
+	"sort"
+	"time"
+)
+
+// SimplifyOptions mirrors the parameters of the frontend track filter
+type SimplifyOptions struct {
+	// MinDistance in meters between two kept points
+	MinDistance float64
+	// MinTimeInterval between two kept points
+	MinTimeInterval time.Duration
+	// Epsilon is the Douglas-Peucker tolerance in meters
+	Epsilon float64
+	// MaxPoints caps the size of the result, zero means no cap
+	MaxPoints int
+}
+
+// Thinner drops points that are both too close in space and in time to the
+// last kept one. It works incrementally, so points can be fed as they come.
+type Thinner struct {
+	minDistance float64
+	minInterval time.Duration
+	last        Point
+	kept        []int
+	count       int
+}
+
+func NewThinner(minDistance float64, minInterval time.Duration) *Thinner {
+	return &Thinner{
+		minDistance: minDistance,
+		minInterval: minInterval,
+	}
+}
+
+// Add feeds the next point, points must be added in time order
+func (t *Thinner) Add(p Point) {
+	index := t.count
+	t.count++
+
+	if len(t.kept) > 0 {
+		interval := p.Time.Sub(t.last.Time)
+		if interval < 0 {
+			interval = -interval
+		}
+		if Distance(t.last, p) < t.minDistance && interval < t.minInterval {
+			return
+		}
+	}
+
+	t.kept = append(t.kept, index)
+	t.last = p
+}
+
+// Len returns how many points have been fed
+func (t *Thinner) Len() int {
+	return t.count
+}
+
+// Indices returns the indices of the kept points, always including the
+// last point fed
+func (t *Thinner) Indices() []int {
+	res := make([]int, len(t.kept), len(t.kept)+1)
+	copy(res, t.kept)
+	if t.count > 0 && (len(res) == 0 || res[len(res)-1] != t.count-1) {
+		res = append(res, t.count-1)
+	}
+	return res
+}
+
+// DouglasPeucker returns the indices of the points kept by the
+// Douglas-Peucker algorithm with the given tolerance in meters
+func DouglasPeucker(points []Point, epsilon float64) []int {
+	n := len(points)
+	if n <= 2 {
+		res := make([]int, n)
+		for i := range res {
+			res[i] = i
+		}
+		return res
+	}
+
+	keep := make([]bool, n)
+	keep[0], keep[n-1] = true, true
+
+	// Iterative to avoid deep recursion on long, straight tracks
+	stack := [][2]int{{0, n - 1}}
+	for len(stack) > 0 {
+		seg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		start, end := seg[0], seg[1]
+
+		maxDist, maxIndex := 0.0, 0
+		for i := start + 1; i < end; i++ {
+			if d := SegmentDistance(points[i], points[start], points[end]); d > maxDist {
+				maxDist, maxIndex = d, i
+			}
+		}
+
+		if maxDist > epsilon {
+			keep[maxIndex] = true
+			stack = append(stack, [2]int{start, maxIndex}, [2]int{maxIndex, end})
+		}
+	}
+
+	res := make([]int, 0, n)
+	for i, k := range keep {
+		if k {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// Downsample evenly picks at most maxPoints of the indices, always keeping
+// the first and the last one
+func Downsample(indices []int, maxPoints int) []int {
+	n := len(indices)
+	if maxPoints <= 0 || n <= maxPoints {
+		return indices
+	}
+	if maxPoints < 2 {
+		maxPoints = 2
+	}
+
+	res := make([]int, 0, maxPoints)
+	step := float64(n-1) / float64(maxPoints-1)
+	for i := 0; i < maxPoints; i++ {
+		res = append(res, indices[int(float64(i)*step+0.5)])
+	}
+	return res
+}
+
+// Simplify thins, simplifies and caps the track, returning the indices of
+// the kept points. Points must be sorted by time.
+func Simplify(points []Point, opts SimplifyOptions) []int {
+	thinner := NewThinner(opts.MinDistance, opts.MinTimeInterval)
+	for _, p := range points {
+		thinner.Add(p)
+	}
+	return SimplifyThinned(points, thinner.Indices(), opts)
+}
+
+// SimplifyThinned runs the Douglas-Peucker and the cap steps of Simplify on
+// indices already produced by a Thinner
+func SimplifyThinned(points []Point, thinned []int, opts SimplifyOptions) []int {
+	subset := make([]Point, len(thinned))
+	for i, idx := range thinned {
+		subset[i] = points[idx]
+	}
+
+	kept := DouglasPeucker(subset, opts.Epsilon)
+	res := make([]int, len(kept))
+	for i, k := range kept {
+		res[i] = thinned[k]
+	}
+	sort.Ints(res)
+
+	return Downsample(res, opts.MaxPoints)
+}
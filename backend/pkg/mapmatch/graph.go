@@ -0,0 +1,238 @@
+// Package mapmatch snaps GPS tracks onto a road network. The network is
+// loaded from GeoJSON, e.g. the roads of the town extracted from an OSM
+// dump with osmium export or ogr2ogr, and the most likely road path is
+// found with a hidden Markov model as described by Newson and Krumm.
+package mapmatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/antoniosarro/saint-tracker/backend/pkg/geo"
+)
+
+// cellSize is the side in meters of the grid indexing the edges
+const cellSize = 100.0
+
+// Graph is an undirected road network in planar meters around its first
+// node. Processions walk, so one-way streets are ignored.
+type Graph struct {
+	origin geo.Point
+	nodes  []node
+	edges  []edge
+	adj    [][]int
+	grid   map[cell][]int
+}
+
+type node struct {
+	x, y float64
+}
+
+type edge struct {
+	from, to int
+	length   float64
+}
+
+type cell struct {
+	x, y int
+}
+
+// candidate is the projection of a fix onto an edge, t being its fraction
+// of the way from the start of the edge
+type candidate struct {
+	edge int
+	t    float64
+	x, y float64
+	dist float64
+}
+
+// LoadFile reads a GeoJSON road network from disk
+func LoadFile(path string) (*Graph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadGeoJSON(f)
+}
+
+// LoadGeoJSON reads the LineString and MultiLineString geometries of a
+// FeatureCollection, a Feature or a bare geometry. Lines sharing a vertex
+// are connected there, other geometries are ignored.
+func LoadGeoJSON(r io.Reader) (*Graph, error) {
+	var doc geoJSON
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON, %w", err)
+	}
+
+	var lines [][][]float64
+	for _, g := range doc.geometries() {
+		switch g.Type {
+		case "LineString":
+			var line [][]float64
+			if err := json.Unmarshal(g.Coordinates, &line); err != nil {
+				return nil, fmt.Errorf("invalid LineString, %w", err)
+			}
+			lines = append(lines, line)
+		case "MultiLineString":
+			var multi [][][]float64
+			if err := json.Unmarshal(g.Coordinates, &multi); err != nil {
+				return nil, fmt.Errorf("invalid MultiLineString, %w", err)
+			}
+			lines = append(lines, multi...)
+		}
+	}
+
+	g := &Graph{grid: make(map[cell][]int)}
+	ids := make(map[[2]int64]int)
+	for _, line := range lines {
+		prev := -1
+		for _, c := range line {
+			if len(c) < 2 {
+				return nil, errors.New("invalid GeoJSON, position with less than two coordinates")
+			}
+			p := geo.Point{Latitude: c[1], Longitude: c[0]}
+			if len(g.nodes) == 0 {
+				g.origin = p
+			}
+
+			// Vertices are shared when equal to the 7th decimal, the
+			// precision OSM stores
+			key := [2]int64{int64(math.Round(p.Latitude * 1e7)), int64(math.Round(p.Longitude * 1e7))}
+			id, ok := ids[key]
+			if !ok {
+				x, y := geo.Project(g.origin, p)
+				id = len(g.nodes)
+				ids[key] = id
+				g.nodes = append(g.nodes, node{x, y})
+				g.adj = append(g.adj, nil)
+			}
+
+			if prev >= 0 && prev != id {
+				g.addEdge(prev, id)
+			}
+			prev = id
+		}
+	}
+
+	if len(g.edges) == 0 {
+		return nil, errors.New("the GeoJSON holds no road")
+	}
+	return g, nil
+}
+
+// Nodes returns the number of road vertices
+func (g *Graph) Nodes() int {
+	return len(g.nodes)
+}
+
+// Edges returns the number of road segments
+func (g *Graph) Edges() int {
+	return len(g.edges)
+}
+
+func (g *Graph) addEdge(from, to int) {
+	a, b := g.nodes[from], g.nodes[to]
+	id := len(g.edges)
+	g.edges = append(g.edges, edge{from, to, math.Hypot(b.x-a.x, b.y-a.y)})
+	g.adj[from] = append(g.adj[from], id)
+	g.adj[to] = append(g.adj[to], id)
+
+	minX, maxX := math.Min(a.x, b.x), math.Max(a.x, b.x)
+	minY, maxY := math.Min(a.y, b.y), math.Max(a.y, b.y)
+	for cx := cellOf(minX); cx <= cellOf(maxX); cx++ {
+		for cy := cellOf(minY); cy <= cellOf(maxY); cy++ {
+			c := cell{cx, cy}
+			g.grid[c] = append(g.grid[c], id)
+		}
+	}
+}
+
+// candidates returns the projections of the point onto the edges within
+// radius meters, the closest first and at most max of them
+func (g *Graph) candidates(x, y, radius float64, max int) []candidate {
+	seen := make(map[int]struct{})
+	var res []candidate
+	for cx := cellOf(x - radius); cx <= cellOf(x+radius); cx++ {
+		for cy := cellOf(y - radius); cy <= cellOf(y+radius); cy++ {
+			for _, id := range g.grid[cell{cx, cy}] {
+				if _, ok := seen[id]; ok {
+					continue
+				}
+				seen[id] = struct{}{}
+
+				c := g.project(id, x, y)
+				if c.dist <= radius {
+					res = append(res, c)
+				}
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].dist < res[j].dist
+	})
+	if len(res) > max {
+		res = res[:max]
+	}
+	return res
+}
+
+// project returns the closest point of an edge to the given one
+func (g *Graph) project(id int, x, y float64) candidate {
+	e := g.edges[id]
+	a, b := g.nodes[e.from], g.nodes[e.to]
+	dx, dy := b.x-a.x, b.y-a.y
+
+	t := 0.0
+	if lenSq := dx*dx + dy*dy; lenSq > 0 {
+		t = math.Max(0, math.Min(1, ((x-a.x)*dx+(y-a.y)*dy)/lenSq))
+	}
+	px, py := a.x+t*dx, a.y+t*dy
+
+	return candidate{edge: id, t: t, x: px, y: py, dist: math.Hypot(x-px, y-py)}
+}
+
+func cellOf(v float64) int {
+	return int(math.Floor(v / cellSize))
+}
+
+// geoJSON covers the three document shapes accepted by LoadGeoJSON
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSON        `json:"geometry"`
+	Features    []*geoJSON      `json:"features"`
+	Geometries  []*geoJSON      `json:"geometries"`
+}
+
+// geometries flattens the document into its geometries
+func (doc *geoJSON) geometries() []*geoJSON {
+	switch doc.Type {
+	case "FeatureCollection":
+		var res []*geoJSON
+		for _, f := range doc.Features {
+			res = append(res, f.geometries()...)
+		}
+		return res
+	case "Feature":
+		if doc.Geometry == nil {
+			return nil
+		}
+		return doc.Geometry.geometries()
+	case "GeometryCollection":
+		var res []*geoJSON
+		for _, g := range doc.Geometries {
+			res = append(res, g.geometries()...)
+		}
+		return res
+	default:
+		return []*geoJSON{doc}
+	}
+}
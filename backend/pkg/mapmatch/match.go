@@ -0,0 +1,184 @@
+package mapmatch
+
+import (
+	"math"
+
+	"github.com/antoniosarro/saint-tracker/backend/pkg/geo"
+)
+
+// DefaultMaxCandidates caps the roads considered per fix when the options
+// leave it unset
+const DefaultMaxCandidates = 8
+
+// maxDetour bounds the road distance searched between two fixes, as a
+// multiple of the straight line between them
+const maxDetour = 3.0
+
+// Options tune the matcher, distances are in meters
+type Options struct {
+	// Radius is how far from a fix roads are searched
+	Radius float64
+	// Sigma is the standard deviation of the GPS error, fixes closer than
+	// twice as much to the previous one are skipped
+	Sigma float64
+	// Beta sets how much a road path longer than the straight line between
+	// two fixes is penalised, the lower the stricter
+	Beta float64
+	// MaxCandidates caps the roads considered per fix
+	MaxCandidates int
+}
+
+// Matcher snaps tracks onto a road network
+type Matcher struct {
+	graph *Graph
+	opts  Options
+}
+
+// step is a fix with its candidate roads and, for each of them, the score
+// of the best path ending there and the candidate of the previous step it
+// comes from
+type step struct {
+	x, y   float64
+	limit  float64
+	cands  []candidate
+	scores []float64
+	back   []int
+	legs   map[[2]int][]int
+}
+
+func New(g *Graph, opts Options) *Matcher {
+	if opts.MaxCandidates <= 0 {
+		opts.MaxCandidates = DefaultMaxCandidates
+	}
+	return &Matcher{graph: g, opts: opts}
+}
+
+// Match returns the road path followed by the points, which must be in
+// time order. Fixes farther than the search radius from any road are
+// skipped, and the path is split where consecutive fixes cannot be joined
+// along the roads.
+func (m *Matcher) Match(points []geo.Point) [][]geo.Point {
+	s := m.NewSession()
+	s.Extend(points)
+	return s.Segments()
+}
+
+// advance runs a Viterbi step from prev to s and reports whether any
+// candidate of s can be reached
+func (m *Matcher) advance(prev, s *step) bool {
+	straight := math.Hypot(s.x-prev.x, s.y-prev.y)
+	s.limit = straight*maxDetour + 2*m.opts.Radius
+
+	for j := range s.cands {
+		s.scores[j] = math.Inf(-1)
+		s.back[j] = -1
+	}
+
+	reached := false
+	for i, a := range prev.cands {
+		if math.IsInf(prev.scores[i], -1) {
+			continue
+		}
+
+		r := m.graph.routesFrom(a, s.limit)
+		for j, b := range s.cands {
+			d, _ := m.graph.distanceTo(r, a, b)
+			if math.IsInf(d, 1) {
+				continue
+			}
+
+			score := prev.scores[i] + m.transition(d, straight) + m.emission(b.dist)
+			if score > s.scores[j] {
+				s.scores[j] = score
+				s.back[j] = i
+				reached = true
+			}
+		}
+	}
+	return reached
+}
+
+// path backtracks the most likely candidates of the steps and returns the
+// road path joining them, nil when it has less than two points
+func (m *Matcher) path(steps []*step) []geo.Point {
+	if len(steps) < 2 {
+		return nil
+	}
+
+	last := steps[len(steps)-1]
+	best := 0
+	for j := range last.scores {
+		if last.scores[j] > last.scores[best] {
+			best = j
+		}
+	}
+
+	chosen := make([]int, len(steps))
+	for k := len(steps) - 1; k >= 0; k-- {
+		chosen[k] = best
+		best = steps[k].back[best]
+	}
+
+	var xs, ys []float64
+	add := func(x, y float64) {
+		if n := len(xs); n > 0 && math.Hypot(x-xs[n-1], y-ys[n-1]) < 0.01 {
+			return
+		}
+		xs = append(xs, x)
+		ys = append(ys, y)
+	}
+
+	first := steps[0].cands[chosen[0]]
+	add(first.x, first.y)
+	for k := 1; k < len(steps); k++ {
+		for _, n := range m.leg(steps[k-1], steps[k], chosen[k-1], chosen[k]) {
+			add(m.graph.nodes[n].x, m.graph.nodes[n].y)
+		}
+		b := steps[k].cands[chosen[k]]
+		add(b.x, b.y)
+	}
+
+	if len(xs) < 2 {
+		return nil
+	}
+	line := make([]geo.Point, len(xs))
+	for i := range xs {
+		line[i] = geo.Unproject(m.graph.origin, xs[i], ys[i])
+	}
+	return line
+}
+
+// leg returns the road nodes between candidate i of prev and candidate j of
+// s. Legs are kept on the step, the path of a session is backtracked again
+// whenever it grows.
+func (m *Matcher) leg(prev, s *step, i, j int) []int {
+	key := [2]int{i, j}
+	if nodes, ok := s.legs[key]; ok {
+		return nodes
+	}
+
+	a, b := prev.cands[i], s.cands[j]
+	var nodes []int
+	r := m.graph.routesFrom(a, s.limit)
+	if _, via := m.graph.distanceTo(r, a, b); via >= 0 {
+		nodes = r.path(via)
+	}
+
+	if s.legs == nil {
+		s.legs = make(map[[2]int][]int)
+	}
+	s.legs[key] = nodes
+	return nodes
+}
+
+// emission is the log likelihood of a fix at dist meters from the road
+func (m *Matcher) emission(dist float64) float64 {
+	z := dist / m.opts.Sigma
+	return -0.5 * z * z
+}
+
+// transition is the log likelihood of a road path of the given length
+// between two fixes that far apart in a straight line
+func (m *Matcher) transition(route, straight float64) float64 {
+	return -math.Abs(route-straight) / m.opts.Beta
+}
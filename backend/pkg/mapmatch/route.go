@@ -0,0 +1,113 @@
+package mapmatch
+
+import (
+	"container/heap"
+	"math"
+)
+
+// routes are the shortest paths from a candidate to every node within a
+// distance limit
+type routes struct {
+	dist map[int]float64
+	prev map[int]int
+}
+
+// routesFrom runs Dijkstra from both ends of the edge of a candidate,
+// starting with the distance along the edge to reach them
+func (g *Graph) routesFrom(c candidate, limit float64) *routes {
+	e := g.edges[c.edge]
+	r := &routes{
+		dist: map[int]float64{e.from: c.t * e.length},
+		prev: make(map[int]int),
+	}
+	if d, ok := r.dist[e.to]; !ok || (1-c.t)*e.length < d {
+		r.dist[e.to] = (1 - c.t) * e.length
+	}
+
+	q := &nodeQueue{}
+	for n, d := range r.dist {
+		heap.Push(q, nodeDist{n, d})
+	}
+
+	for q.Len() > 0 {
+		cur := heap.Pop(q).(nodeDist)
+		if cur.dist > r.dist[cur.node] {
+			continue
+		}
+		for _, id := range g.adj[cur.node] {
+			e := g.edges[id]
+			next := e.to
+			if next == cur.node {
+				next = e.from
+			}
+
+			d := cur.dist + e.length
+			if d > limit {
+				continue
+			}
+			if old, ok := r.dist[next]; ok && old <= d {
+				continue
+			}
+			r.dist[next] = d
+			r.prev[next] = cur.node
+			heap.Push(q, nodeDist{next, d})
+		}
+	}
+	return r
+}
+
+// distanceTo returns the road distance from the source candidate a to b,
+// infinite when b is out of reach, along with the node the path enters the
+// edge of b from, -1 when both are on the same edge
+func (g *Graph) distanceTo(r *routes, a, b candidate) (float64, int) {
+	e := g.edges[b.edge]
+	if a.edge == b.edge {
+		return math.Abs(b.t-a.t) * e.length, -1
+	}
+
+	best, via := math.Inf(1), -1
+	if d, ok := r.dist[e.from]; ok && d+b.t*e.length < best {
+		best, via = d+b.t*e.length, e.from
+	}
+	if d, ok := r.dist[e.to]; ok && d+(1-b.t)*e.length < best {
+		best, via = d+(1-b.t)*e.length, e.to
+	}
+	return best, via
+}
+
+// path returns the nodes from the source up to the given one
+func (r *routes) path(to int) []int {
+	var res []int
+	for n := to; ; {
+		res = append(res, n)
+		prev, ok := r.prev[n]
+		if !ok {
+			break
+		}
+		n = prev
+	}
+
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+type nodeDist struct {
+	node int
+	dist float64
+}
+
+// nodeQueue is the Dijkstra priority queue, closest node first
+type nodeQueue []nodeDist
+
+func (q nodeQueue) Len() int            { return len(q) }
+func (q nodeQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(nodeDist)) }
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
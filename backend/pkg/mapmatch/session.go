@@ -0,0 +1,90 @@
+package mapmatch
+
+import (
+	"math"
+
+	"github.com/antoniosarro/saint-tracker/backend/pkg/geo"
+)
+
+// Session matches a track incrementally, as points are appended to it. The
+// Viterbi state of the segment in progress is kept so that a new fix only
+// costs its own step, the segments closed by a break are final. A Session
+// is not safe for concurrent use.
+type Session struct {
+	m      *Matcher
+	fed    int
+	closed [][]geo.Point
+	steps  []*step
+	open   []geo.Point
+	stale  bool
+}
+
+// NewSession starts matching a new track
+func (m *Matcher) NewSession() *Session {
+	return &Session{m: m}
+}
+
+// Len returns how many points were fed to the session
+func (s *Session) Len() int {
+	return s.fed
+}
+
+// Extend feeds the points appended to the track, which must follow in time
+// order the ones already fed
+func (s *Session) Extend(points []geo.Point) {
+	m := s.m
+	for _, p := range points {
+		s.fed++
+		x, y := geo.Project(m.graph.origin, p)
+
+		var prev *step
+		if len(s.steps) > 0 {
+			prev = s.steps[len(s.steps)-1]
+			if math.Hypot(x-prev.x, y-prev.y) < 2*m.opts.Sigma {
+				continue
+			}
+		}
+
+		cands := m.graph.candidates(x, y, m.opts.Radius, m.opts.MaxCandidates)
+		if len(cands) == 0 {
+			continue
+		}
+
+		st := &step{
+			x:      x,
+			y:      y,
+			cands:  cands,
+			scores: make([]float64, len(cands)),
+			back:   make([]int, len(cands)),
+		}
+		if prev == nil || !m.advance(prev, st) {
+			if line := m.path(s.steps); line != nil {
+				s.closed = append(s.closed, line)
+			}
+			s.steps = nil
+			for j, c := range cands {
+				st.scores[j] = m.emission(c.dist)
+				st.back[j] = -1
+			}
+		}
+		s.steps = append(s.steps, st)
+		s.stale = true
+	}
+}
+
+// Segments returns the road path of the points fed so far. The segment in
+// progress is backtracked again after new fixes, a later fix may change the
+// roads chosen before it.
+func (s *Session) Segments() [][]geo.Point {
+	if s.stale {
+		s.open = s.m.path(s.steps)
+		s.stale = false
+	}
+
+	res := make([][]geo.Point, 0, len(s.closed)+1)
+	res = append(res, s.closed...)
+	if s.open != nil {
+		res = append(res, s.open)
+	}
+	return res
+}
@@ -0,0 +1,217 @@
+package trackio
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVHeader are the columns written by CSVWriter, ReadCSV accepts them in
+// any order along with a few common aliases
+var CSVHeader = []string{"created_at", "latitude", "longitude", "speed", "altitude", "heading", "hdop", "satellites", "accuracy"}
+
+// CSVWriter streams track points as CSV, one row per point. CSV has no
+// room for waypoints so they are left out.
+type CSVWriter struct {
+	w *csv.Writer
+}
+
+func NewCSVWriter(w io.Writer, meta Metadata) (*CSVWriter, error) {
+	c := &CSVWriter{w: csv.NewWriter(w)}
+	return c, c.w.Write(CSVHeader)
+}
+
+func (c *CSVWriter) WriteWaypoint(wpt Waypoint) error {
+	return nil
+}
+
+func (c *CSVWriter) WritePoint(p Point) error {
+	return c.w.Write([]string{
+		formatTime(p.Time),
+		formatCoord(p.Latitude),
+		formatCoord(p.Longitude),
+		strconv.FormatFloat(p.Speed, 'f', -1, 64),
+		formatOptional(p.Altitude, 1),
+		formatOptional(p.Heading, 1),
+		formatOptional(p.HDOP, 2),
+		formatOptionalInt(p.Satellites),
+		formatOptional(p.Accuracy, 1),
+	})
+}
+
+// Close flushes the output, the underlying writer is left open
+func (c *CSVWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Flush sends the buffered output, e.g. to keep a slow download going
+func (c *CSVWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvColumns maps the accepted header names to the CSVHeader ones
+var csvColumns = map[string]string{
+	"created_at": "created_at",
+	"timestamp":  "created_at",
+	"time":       "created_at",
+	"latitude":   "latitude",
+	"lat":        "latitude",
+	"longitude":  "longitude",
+	"lon":        "longitude",
+	"lng":        "longitude",
+	"speed":      "speed",
+	"altitude":   "altitude",
+	"alt":        "altitude",
+	"ele":        "altitude",
+	"elevation":  "altitude",
+	"heading":    "heading",
+	"course":     "heading",
+	"bearing":    "heading",
+	"hdop":       "hdop",
+	"satellites": "satellites",
+	"sat":        "satellites",
+	"sats":       "satellites",
+	"accuracy":   "accuracy",
+}
+
+// ReadFunc receives each point read along with its line number. err is set
+// instead of the point when that line could not be parsed, returning an
+// error from ReadFunc stops the reading.
+type ReadFunc func(line int, p Point, err error) error
+
+// ReadCSV reads track points from a CSV with a header row. Timestamps are
+// unix seconds or RFC 3339 dates, speed is optional and in km/h, as are
+// the GNSS columns.
+func ReadCSV(r io.Reader, fn ReadFunc) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("trackio: empty csv")
+		}
+		return err
+	}
+
+	index := make(map[string]int)
+	for i, name := range header {
+		if col, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			index[col] = i
+		}
+	}
+	for _, col := range []string{"created_at", "latitude", "longitude"} {
+		if _, ok := index[col]; !ok {
+			return fmt.Errorf("trackio: csv header has no %s column", col)
+		}
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		// FieldPos is only valid after a successful read, a malformed line
+		// reports its position in the error. Any other error comes from the
+		// underlying reader, which would keep failing.
+		var line int
+		var p Point
+		var parseErr *csv.ParseError
+		switch {
+		case err == nil:
+			line, _ = cr.FieldPos(0)
+			p, err = parseCSVRecord(record, index)
+		case errors.As(err, &parseErr):
+			line = parseErr.Line
+		default:
+			return err
+		}
+		if err := fn(line, p, err); err != nil {
+			return err
+		}
+	}
+}
+
+func parseCSVRecord(record []string, index map[string]int) (Point, error) {
+	var p Point
+
+	field := func(col string) string {
+		i, ok := index[col]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var err error
+	if p.Latitude, err = strconv.ParseFloat(field("latitude"), 64); err != nil {
+		return p, fmt.Errorf("invalid latitude %q", field("latitude"))
+	}
+	if p.Longitude, err = strconv.ParseFloat(field("longitude"), 64); err != nil {
+		return p, fmt.Errorf("invalid longitude %q", field("longitude"))
+	}
+	if p.Time, err = parseTime(field("created_at")); err != nil {
+		return p, err
+	}
+	if speed := field("speed"); speed != "" {
+		if p.Speed, err = strconv.ParseFloat(speed, 64); err != nil {
+			return p, fmt.Errorf("invalid speed %q", speed)
+		}
+	}
+
+	optional := []struct {
+		col string
+		dst **float64
+	}{
+		{"altitude", &p.Altitude},
+		{"heading", &p.Heading},
+		{"hdop", &p.HDOP},
+		{"accuracy", &p.Accuracy},
+	}
+	for _, o := range optional {
+		value := field(o.col)
+		if value == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid %s %q", o.col, value)
+		}
+		*o.dst = &v
+	}
+	if sat := field("satellites"); sat != "" {
+		v, err := strconv.Atoi(sat)
+		if err != nil {
+			return p, fmt.Errorf("invalid satellites %q", sat)
+		}
+		p.Satellites = &v
+	}
+	return p, nil
+}
+
+func formatOptionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+// parseTime accepts unix seconds or an RFC 3339 date
+func parseTime(value string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid timestamp %q, expected unix seconds or an RFC 3339 date", value)
+	}
+	return t.UTC(), nil
+}
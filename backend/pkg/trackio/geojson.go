@@ -0,0 +1,131 @@
+package trackio
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// GeoJSONWriter streams a GeoJSON FeatureCollection: a Point feature per
+// waypoint followed by a LineString feature for the track. A track of a
+// single point is written as a Point, since a LineString needs two.
+type GeoJSONWriter struct {
+	w        *bufio.Writer
+	name     string
+	features int
+	inTrack  bool
+	first    *Point
+	count    int
+	start    time.Time
+	end      time.Time
+	maxSpeed float64
+}
+
+func NewGeoJSONWriter(w io.Writer, meta Metadata) (*GeoJSONWriter, error) {
+	g := &GeoJSONWriter{w: bufio.NewWriter(w), name: meta.Name}
+
+	g.w.WriteString(`{"type":"FeatureCollection","name":`)
+	g.writeJSON(meta.Name)
+	_, err := g.w.WriteString(`,"features":[` + "\n")
+	return g, err
+}
+
+func (g *GeoJSONWriter) WriteWaypoint(wpt Waypoint) error {
+	if g.inTrack {
+		return ErrWaypointAfterTrack
+	}
+
+	props := map[string]interface{}{
+		"name":        wpt.Name,
+		"description": wpt.Description,
+	}
+	if !wpt.Time.IsZero() {
+		props["time"] = formatTime(wpt.Time)
+	}
+	return g.writePointFeature(wpt.Latitude, wpt.Longitude, props)
+}
+
+func (g *GeoJSONWriter) WritePoint(p Point) error {
+	g.inTrack = true
+	g.count++
+	if g.count == 1 {
+		g.start = p.Time
+		g.first = &p
+	}
+	g.end = p.Time
+	g.maxSpeed = max(g.maxSpeed, p.Speed)
+
+	// The LineString is opened on the second point, once it is certain to
+	// be valid
+	if g.count == 2 {
+		g.separator()
+		g.w.WriteString(`{"type":"Feature","geometry":{"type":"LineString","coordinates":[` + "\n")
+		g.writePosition(g.first.Latitude, g.first.Longitude)
+	}
+	if g.count >= 2 {
+		g.w.WriteString(",\n")
+		g.writePosition(p.Latitude, p.Longitude)
+	}
+	return nil
+}
+
+// Close ends the document and flushes it, the underlying writer is left
+// open
+func (g *GeoJSONWriter) Close() error {
+	props := map[string]interface{}{
+		"name":      g.name,
+		"points":    g.count,
+		"max_speed": g.maxSpeed,
+	}
+	if g.count > 0 {
+		props["start_time"] = formatTime(g.start)
+		props["end_time"] = formatTime(g.end)
+	}
+
+	switch {
+	case g.count == 1:
+		g.writePointFeature(g.first.Latitude, g.first.Longitude, props)
+	case g.count > 1:
+		g.w.WriteString("\n]},\"properties\":")
+		g.writeJSON(props)
+		g.w.WriteString("}")
+	}
+
+	g.w.WriteString("\n]}\n")
+	return g.w.Flush()
+}
+
+// Flush sends the buffered output, e.g. to keep a slow download going
+func (g *GeoJSONWriter) Flush() error {
+	return g.w.Flush()
+}
+
+func (g *GeoJSONWriter) writePointFeature(lat, lng float64, props map[string]interface{}) error {
+	g.separator()
+	g.w.WriteString(`{"type":"Feature","geometry":{"type":"Point","coordinates":`)
+	g.writePosition(lat, lng)
+	g.w.WriteString(`},"properties":`)
+	g.writeJSON(props)
+	_, err := g.w.WriteString("}")
+	return err
+}
+
+// separator goes before every feature but the first one
+func (g *GeoJSONWriter) separator() {
+	if g.features > 0 {
+		g.w.WriteString(",\n")
+	}
+	g.features++
+}
+
+// writePosition writes a GeoJSON position, longitude first
+func (g *GeoJSONWriter) writePosition(lat, lng float64) {
+	g.w.WriteString("[" + strconv.FormatFloat(lng, 'f', 7, 64) + "," + strconv.FormatFloat(lat, 'f', 7, 64) + "]")
+}
+
+func (g *GeoJSONWriter) writeJSON(v interface{}) {
+	b, _ := json.Marshal(v)
+	g.w.Write(b)
+}
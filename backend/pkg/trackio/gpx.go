@@ -0,0 +1,196 @@
+package trackio
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const gpxHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="saint-tracker"
+  xmlns="http://www.topografix.com/GPX/1/1"
+  xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v2"
+  xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
+  xsi:schemaLocation="http://www.topografix.com/GPX/1/1 http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v2 http://www8.garmin.com/xmlschemas/TrackPointExtensionv2.xsd">
+`
+
+// GPXWriter streams a GPX 1.1 document with a single track. Speeds are
+// written in the Garmin TrackPointExtension, in m/s, along with headings.
+// GPX has no element for the accuracy, it is left out.
+type GPXWriter struct {
+	w       *bufio.Writer
+	name    string
+	inTrack bool
+}
+
+// NewGPXWriter writes the document header and metadata
+func NewGPXWriter(w io.Writer, meta Metadata) (*GPXWriter, error) {
+	g := &GPXWriter{w: bufio.NewWriter(w), name: meta.Name}
+
+	g.w.WriteString(gpxHeader)
+	g.w.WriteString("  <metadata>\n")
+	g.element("    ", "name", meta.Name)
+	g.element("    ", "desc", meta.Description)
+	if !meta.Time.IsZero() {
+		g.element("    ", "time", formatTime(meta.Time))
+	}
+	_, err := g.w.WriteString("  </metadata>\n")
+	return g, err
+}
+
+func (g *GPXWriter) WriteWaypoint(wpt Waypoint) error {
+	if g.inTrack {
+		return ErrWaypointAfterTrack
+	}
+
+	fmt.Fprintf(g.w, "  <wpt lat=\"%s\" lon=\"%s\">\n", formatCoord(wpt.Latitude), formatCoord(wpt.Longitude))
+	if !wpt.Time.IsZero() {
+		g.element("    ", "time", formatTime(wpt.Time))
+	}
+	g.element("    ", "name", wpt.Name)
+	g.element("    ", "desc", wpt.Description)
+	_, err := g.w.WriteString("  </wpt>\n")
+	return err
+}
+
+func (g *GPXWriter) WritePoint(p Point) error {
+	if !g.inTrack {
+		g.startTrack()
+	}
+
+	fmt.Fprintf(g.w, "      <trkpt lat=\"%s\" lon=\"%s\">\n", formatCoord(p.Latitude), formatCoord(p.Longitude))
+	g.element("        ", "ele", formatOptional(p.Altitude, 1))
+	g.element("        ", "time", formatTime(p.Time))
+	if p.Satellites != nil {
+		g.element("        ", "sat", strconv.Itoa(*p.Satellites))
+	}
+	g.element("        ", "hdop", formatOptional(p.HDOP, 2))
+	g.w.WriteString("        <extensions><gpxtpx:TrackPointExtension>")
+	fmt.Fprintf(g.w, "<gpxtpx:speed>%s</gpxtpx:speed>", strconv.FormatFloat(p.Speed/3.6, 'f', 2, 64))
+	if p.Heading != nil {
+		fmt.Fprintf(g.w, "<gpxtpx:course>%s</gpxtpx:course>", formatOptional(p.Heading, 1))
+	}
+	_, err := g.w.WriteString("</gpxtpx:TrackPointExtension></extensions>\n      </trkpt>\n")
+	return err
+}
+
+// Close ends the document and flushes it, the underlying writer is left
+// open
+func (g *GPXWriter) Close() error {
+	if !g.inTrack {
+		g.startTrack()
+	}
+	g.w.WriteString("    </trkseg>\n  </trk>\n</gpx>\n")
+	return g.w.Flush()
+}
+
+// Flush sends the buffered output, e.g. to keep a slow download going
+func (g *GPXWriter) Flush() error {
+	return g.w.Flush()
+}
+
+func (g *GPXWriter) startTrack() {
+	g.inTrack = true
+	g.w.WriteString("  <trk>\n")
+	g.element("    ", "name", g.name)
+	g.w.WriteString("    <trkseg>\n")
+}
+
+// element writes a text element, skipping empty values
+func (g *GPXWriter) element(indent, name, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(g.w, "%s<%s>", indent, name)
+	xml.EscapeText(g.w, []byte(value))
+	fmt.Fprintf(g.w, "</%s>\n", name)
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 7, 64)
+}
+
+// formatOptional formats an optional value, empty when unknown
+func formatOptional(v *float64, prec int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', prec, 64)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// gpxTrackPoint is a trkpt as found in GPX 1.0 and 1.1 files. Speed and
+// course are GPX 1.0 elements, GPX 1.1 files carry them in an extension.
+type gpxTrackPoint struct {
+	Latitude   float64  `xml:"lat,attr"`
+	Longitude  float64  `xml:"lon,attr"`
+	Elevation  *float64 `xml:"ele"`
+	Time       string   `xml:"time"`
+	Satellites *int     `xml:"sat"`
+	HDOP       *float64 `xml:"hdop"`
+	Speed      *float64 `xml:"speed"`
+	Course     *float64 `xml:"course"`
+	Extensions struct {
+		Speed  *float64 `xml:"TrackPointExtension>speed"`
+		Course *float64 `xml:"TrackPointExtension>course"`
+	} `xml:"extensions"`
+}
+
+// ReadGPX reads the track points of every track in a GPX document, in
+// document order. Speeds found in GPX 1.0 or in the Garmin extension are
+// converted from m/s to km/h, elevation, course, satellites and HDOP are
+// read when present.
+func ReadGPX(r io.Reader, fn ReadFunc) error {
+	dec := xml.NewDecoder(r)
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "trkpt" {
+			continue
+		}
+		line, _ := dec.InputPos()
+
+		var tp gpxTrackPoint
+		if err := dec.DecodeElement(&tp, &start); err != nil {
+			return err
+		}
+
+		p := Point{
+			Latitude:   tp.Latitude,
+			Longitude:  tp.Longitude,
+			Altitude:   tp.Elevation,
+			Satellites: tp.Satellites,
+			HDOP:       tp.HDOP,
+			Heading:    tp.Course,
+		}
+		if tp.Speed != nil {
+			p.Speed = *tp.Speed * 3.6
+		} else if tp.Extensions.Speed != nil {
+			p.Speed = *tp.Extensions.Speed * 3.6
+		}
+		if p.Heading == nil {
+			p.Heading = tp.Extensions.Course
+		}
+
+		p.Time, err = parseTime(strings.TrimSpace(tp.Time))
+		if err := fn(line, p, err); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package trackio
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const kmlHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+<Document>
+`
+
+// KMLWriter streams a KML 2.2 document: a Placemark per waypoint followed
+// by a LineString Placemark for the track. A track of a single point is
+// written as a Point, since a LineString needs two.
+type KMLWriter struct {
+	w       *bufio.Writer
+	name    string
+	inTrack bool
+	first   *Point
+	count   int
+}
+
+func NewKMLWriter(w io.Writer, meta Metadata) (*KMLWriter, error) {
+	k := &KMLWriter{w: bufio.NewWriter(w), name: meta.Name}
+
+	k.w.WriteString(kmlHeader)
+	k.element("  ", "name", meta.Name)
+	k.element("  ", "description", meta.Description)
+	_, err := k.w.WriteString(`  <Style id="track"><LineStyle><color>ff0000ff</color><width>4</width></LineStyle></Style>` + "\n")
+	return k, err
+}
+
+func (k *KMLWriter) WriteWaypoint(wpt Waypoint) error {
+	if k.inTrack {
+		return ErrWaypointAfterTrack
+	}
+
+	k.w.WriteString("  <Placemark>\n")
+	k.element("    ", "name", wpt.Name)
+	k.element("    ", "description", wpt.Description)
+	if !wpt.Time.IsZero() {
+		fmt.Fprintf(k.w, "    <TimeStamp><when>%s</when></TimeStamp>\n", formatTime(wpt.Time))
+	}
+	fmt.Fprintf(k.w, "    <Point><coordinates>%s</coordinates></Point>\n", kmlCoord(wpt.Latitude, wpt.Longitude))
+	_, err := k.w.WriteString("  </Placemark>\n")
+	return err
+}
+
+func (k *KMLWriter) WritePoint(p Point) error {
+	k.inTrack = true
+	k.count++
+	if k.count == 1 {
+		k.first = &p
+		return nil
+	}
+
+	// The LineString is opened on the second point, once it is certain to
+	// be valid
+	if k.count == 2 {
+		k.w.WriteString("  <Placemark>\n")
+		k.element("    ", "name", k.name)
+		k.w.WriteString("    <styleUrl>#track</styleUrl>\n")
+		k.w.WriteString("    <LineString><tessellate>1</tessellate><coordinates>\n")
+		k.w.WriteString("      " + kmlCoord(k.first.Latitude, k.first.Longitude) + "\n")
+	}
+	_, err := k.w.WriteString("      " + kmlCoord(p.Latitude, p.Longitude) + "\n")
+	return err
+}
+
+// Close ends the document and flushes it, the underlying writer is left
+// open
+func (k *KMLWriter) Close() error {
+	switch {
+	case k.count == 1:
+		k.w.WriteString("  <Placemark>\n")
+		k.element("    ", "name", k.name)
+		fmt.Fprintf(k.w, "    <Point><coordinates>%s</coordinates></Point>\n", kmlCoord(k.first.Latitude, k.first.Longitude))
+		k.w.WriteString("  </Placemark>\n")
+	case k.count > 1:
+		k.w.WriteString("    </coordinates></LineString>\n  </Placemark>\n")
+	}
+
+	k.w.WriteString("</Document>\n</kml>\n")
+	return k.w.Flush()
+}
+
+// Flush sends the buffered output, e.g. to keep a slow download going
+func (k *KMLWriter) Flush() error {
+	return k.w.Flush()
+}
+
+// element writes a text element, skipping empty values
+func (k *KMLWriter) element(indent, name, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(k.w, "%s<%s>", indent, name)
+	xml.EscapeText(k.w, []byte(value))
+	fmt.Fprintf(k.w, "</%s>\n", name)
+}
+
+// kmlCoord formats a KML coordinate tuple, longitude first
+func kmlCoord(lat, lng float64) string {
+	return strconv.FormatFloat(lng, 'f', 7, 64) + "," + strconv.FormatFloat(lat, 'f', 7, 64)
+}
@@ -0,0 +1,45 @@
+// Package trackio writes recorded tracks in the formats understood by
+// standard GPS tools. Writers stream their output, points are written as
+// they are fed and never kept in memory.
+package trackio
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrWaypointAfterTrack is returned when a waypoint is written once the
+// track has started. Writers stream the track last, as GPX 1.1 requires.
+var ErrWaypointAfterTrack = errors.New("trackio: waypoints must be written before the track")
+
+// Metadata describes the whole document
+type Metadata struct {
+	Name        string
+	Description string
+	Time        time.Time
+}
+
+// Point is a recorded track point, Speed is in km/h. The GNSS fields are
+// nil when unknown, formats without room for them leave them out.
+// Altitude and Accuracy are in meters, Heading in degrees from north.
+type Point struct {
+	Latitude   float64
+	Longitude  float64
+	Time       time.Time
+	Speed      float64
+	Altitude   *float64
+	Heading    *float64
+	HDOP       *float64
+	Satellites *int
+	Accuracy   *float64
+}
+
+// Waypoint is a named place along the track, such as a stop. Time is the
+// arrival time, zero when the place was never reached.
+type Waypoint struct {
+	Name        string
+	Description string
+	Latitude    float64
+	Longitude   float64
+	Time        time.Time
+}